@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/events"
+	"golang-restaurant-management/models"
+)
+
+const availabilityTopic = "availability"
+
+const (
+	offSaleUnavailable = "UNAVAILABLE"
+	offSaleSoldOut     = "SOLD_OUT"
+	offSaleLowStock    = "LOW_STOCK"
+)
+
+// AvailabilityRequest takes a food off sale or puts it back, and sets or,
+// with unlimited, clears the count of portions left.
+type AvailabilityRequest struct {
+	Available *bool `json:"available"`
+	Remaining *int  `json:"remaining" validate:"omitempty,min=0"`
+	Unlimited bool  `json:"unlimited"`
+}
+
+// FoodAvailability is what a waiter's tablet needs to grey a food out. Reason
+// says why a food is off sale: UNAVAILABLE, SOLD_OUT or LOW_STOCK.
+type FoodAvailability struct {
+	Food_id   string `json:"food_id"`
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Remaining *int   `json:"remaining"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+func GetFoodAvailability(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	availability, err := foodAvailabilities(ctx, bson.M{})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing food availability"})
+	}
+	return c.JSON(availability)
+}
+
+// AvailabilityFeed streams changes to what can be ordered, starting with
+// every food's availability.
+func AvailabilityFeed(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	feed, unsubscribe := events.Subscribe(availabilityTopic)
+
+	availability, err := foodAvailabilities(ctx, bson.M{})
+	if err != nil {
+		unsubscribe()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing food availability"})
+	}
+
+	return events.Stream(c, feed, unsubscribe, events.Event{Type: "snapshot", Data: availability})
+}
+
+func SetFoodAvailability(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request AvailabilityRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if request.Unlimited && request.Remaining != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "remaining cannot be given with unlimited"})
+	}
+
+	updateObj := bson.D{{Key: "updated_at", Value: time.Now()}}
+	if request.Available != nil {
+		updateObj = append(updateObj, bson.E{Key: "available", Value: *request.Available})
+	}
+	if request.Remaining != nil {
+		updateObj = append(updateObj, bson.E{Key: "remaining", Value: *request.Remaining})
+	}
+	if request.Unlimited {
+		updateObj = append(updateObj, bson.E{Key: "remaining", Value: nil})
+	}
+
+	var food models.Food
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := foodCollection.FindOneAndUpdate(ctx,
+		bson.M{"food_id": c.Params("food_id")},
+		bson.D{{Key: "$set", Value: updateObj}},
+		opts,
+	).Decode(&food)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "food was not found"})
+	}
+
+	availability := foodAvailability(food)
+	events.Publish(availabilityTopic, events.Event{Type: "availability", Data: []FoodAvailability{availability}})
+	return c.JSON(availability)
+}
+
+func foodAvailability(food models.Food) FoodAvailability {
+	availability := FoodAvailability{
+		Food_id:   food.Food_id,
+		Remaining: food.Remaining,
+		Reason:    offSaleReason(food),
+	}
+	if food.Name != nil {
+		availability.Name = *food.Name
+	}
+	availability.Available = availability.Reason == ""
+	return availability
+}
+
+// offSaleReason is why the food cannot be ordered, or empty when it can.
+func offSaleReason(food models.Food) string {
+	switch {
+	case food.Available != nil && !*food.Available:
+		return offSaleUnavailable
+	case food.Remaining != nil && *food.Remaining <= 0:
+		return offSaleSoldOut
+	case len(food.Low_stock_ingredients) > 0:
+		return offSaleLowStock
+	}
+	return ""
+}
+
+// offSaleMessage explains to whoever is ordering why the food is off sale.
+func offSaleMessage(food models.Food) string {
+	switch offSaleReason(food) {
+	case offSaleUnavailable:
+		return *food.Name + " is not available"
+	case offSaleSoldOut:
+		return *food.Name + " is sold out"
+	case offSaleLowStock:
+		return *food.Name + " is off sale until it is restocked"
+	}
+	return ""
+}
+
+func foodAvailabilities(ctx context.Context, filter bson.M) ([]FoodAvailability, error) {
+	var foods []models.Food
+	result, err := foodCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err := result.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+
+	availability := make([]FoodAvailability, 0, len(foods))
+	for _, food := range foods {
+		availability = append(availability, foodAvailability(food))
+	}
+	return availability, nil
+}
+
+// publishAvailability tells connected clients the current availability of
+// the foods the filter matches.
+func publishAvailability(ctx context.Context, filter bson.M) {
+	availability, err := foodAvailabilities(ctx, filter)
+	if err != nil {
+		log.Printf("availability: foods were not loaded: %v", err)
+		return
+	}
+	if len(availability) > 0 {
+		events.Publish(availabilityTopic, events.Event{Type: "availability", Data: availability})
+	}
+}
+
+// foodCountChanges works out, by food, how many more portions order items
+// use after a change and how many they give back. Cancelled items use none;
+// voided ones were still made.
+func foodCountChanges(changes ...itemStockChange) (map[string]int, map[string]int) {
+	diff := map[string]int{}
+	count := func(item *models.OrderItem, sign int) {
+		if item == nil || item.Food_id == nil {
+			return
+		}
+		if item.Item_status != nil && *item.Item_status == models.ItemCancelled {
+			return
+		}
+		quantity := 1
+		if item.Quantity != nil {
+			quantity = *item.Quantity
+		}
+		diff[*item.Food_id] += sign * quantity
+	}
+	for _, change := range changes {
+		count(change.before, -1)
+		count(change.after, 1)
+	}
+
+	needed, freed := map[string]int{}, map[string]int{}
+	for foodId, portions := range diff {
+		if portions > 0 {
+			needed[foodId] = portions
+		} else if portions < 0 {
+			freed[foodId] = -portions
+		}
+	}
+	return needed, freed
+}
+
+// reserveFoods counts portions off the foods that have a limited number
+// left. Either every food has enough and all are counted down, or none are.
+func reserveFoods(ctx context.Context, portions map[string]int) (int, string) {
+	reserved := map[string]int{}
+	for foodId, quantity := range portions {
+		result, err := foodCollection.UpdateOne(ctx,
+			bson.M{"food_id": foodId, "remaining": bson.M{"$gte": quantity}},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "remaining", Value: -quantity}}}},
+		)
+		if err != nil {
+			releaseFoods(ctx, reserved)
+			return http.StatusInternalServerError, "error occurred while counting portions"
+		}
+		if result.MatchedCount > 0 {
+			reserved[foodId] = quantity
+			continue
+		}
+
+		// Nothing matched, so either the food is not counted or there are not
+		// enough portions left.
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil || food.Remaining == nil {
+			continue
+		}
+		releaseFoods(ctx, reserved)
+		if *food.Remaining <= 0 {
+			return http.StatusConflict, *food.Name + " is sold out"
+		}
+		return http.StatusConflict, "only " + strconv.Itoa(*food.Remaining) + " of " + *food.Name + " left"
+	}
+
+	if len(reserved) > 0 {
+		publishAvailability(ctx, bson.M{"food_id": bson.M{"$in": foodIdsOf(reserved)}})
+	}
+	return 0, ""
+}
+
+// releaseFoods gives portions back to the foods that are counted.
+func releaseFoods(ctx context.Context, portions map[string]int) {
+	released := map[string]int{}
+	for foodId, quantity := range portions {
+		result, err := foodCollection.UpdateOne(ctx,
+			bson.M{"food_id": foodId, "remaining": bson.M{"$type": "number"}},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "remaining", Value: quantity}}}},
+		)
+		if err != nil {
+			log.Printf("availability: %d portions of %s were not given back: %v", quantity, foodId, err)
+			continue
+		}
+		if result.MatchedCount > 0 {
+			released[foodId] = quantity
+		}
+	}
+
+	if len(released) > 0 {
+		publishAvailability(ctx, bson.M{"food_id": bson.M{"$in": foodIdsOf(released)}})
+	}
+}
+
+func foodIdsOf(portions map[string]int) []string {
+	foodIds := make([]string, 0, len(portions))
+	for foodId := range portions {
+		foodIds = append(foodIds, foodId)
+	}
+	return foodIds
+}
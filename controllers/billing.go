@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
+)
+
+// Items in these states are no longer on the bill.
+var unbilledItemStatuses = []string{models.ItemCancelled, models.ItemVoided}
+
+// billedItems matches the order items an order is billed for. Bundle
+// components are billed through their bundle.
+func billedItems(orderId string) bson.M {
+	return bson.M{"order_id": orderId, "item_status": bson.M{"$nin": unbilledItemStatuses}, "bundle_item_id": nil}
+}
+
+// Everything an invoice charges for, priced and taxed with the rules that
+// were in effect when the invoice was created.
+func invoiceBill(ctx context.Context, invoice models.Invoice) (helper.Bill, error) {
+	lines, err := orderBillLines(ctx, invoice.Order_id)
+	if err != nil {
+		return helper.Bill{}, err
+	}
+
+	rules, err := taxRulesAt(ctx, invoice.Created_at)
+	if err != nil {
+		return helper.Bill{}, err
+	}
+
+	if invoice.Order_item_ids != nil {
+		lines = linesFor(lines, invoice.Order_item_ids)
+	}
+
+	bill := helper.BuildBill(lines, invoice.Discounts, rules)
+	bill = helper.AddServiceCharge(bill, invoice.Service_charge)
+	if invoice.Split_part != nil && invoice.Split_of != nil {
+		bill = helper.ShareBill(bill, *invoice.Split_part, *invoice.Split_of)
+	}
+	return bill, nil
+}
+
+func linesFor(lines []helper.BillLine, orderItemIds []string) []helper.BillLine {
+	wanted := make(map[string]bool, len(orderItemIds))
+	for _, id := range orderItemIds {
+		wanted[id] = true
+	}
+
+	kept := []helper.BillLine{}
+	for _, line := range lines {
+		if wanted[line.Order_item_id] {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+func amountPaid(invoice models.Invoice) models.Money {
+	paid := models.NewMoney(0)
+	for _, payment := range invoice.Payments {
+		paid = paid.Add(payment.Amount)
+	}
+	return paid
+}
+
+// Tips are paid on top of the bill, so they never count towards the balance.
+func tipsPaid(invoice models.Invoice) models.Money {
+	tips := models.NewMoney(0)
+	for _, payment := range invoice.Payments {
+		tips = tips.Add(payment.Tip)
+	}
+	return tips
+}
+
+func orderBillLines(ctx context.Context, orderId string) ([]helper.BillLine, error) {
+	result, err := orderItemCollection.Find(ctx, billedItems(orderId))
+	if err != nil {
+		return nil, err
+	}
+
+	var orderItems []models.OrderItem
+	if err := result.All(ctx, &orderItems); err != nil {
+		return nil, err
+	}
+
+	foods, err := foodsById(ctx, orderItems)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := menuCategories(ctx, foods)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]helper.BillLine, 0, len(orderItems))
+	for _, orderItem := range orderItems {
+		food := foods[*orderItem.Food_id]
+
+		line := helper.BillLine{
+			Order_item_id: orderItem.Order_item_id,
+			Food_id:       *orderItem.Food_id,
+			Size:          orderItem.Size,
+			Quantity:      int64(*orderItem.Quantity - orderItem.Voided_quantity),
+			Unit_price:    models.NewMoney(0),
+		}
+		if food.Name != nil {
+			line.Food_name = *food.Name
+		}
+		if food.Menu_id != nil {
+			line.Category = categories[*food.Menu_id]
+		}
+		if orderItem.Unit_price != nil {
+			line.Unit_price = *orderItem.Unit_price
+		} else if food.Price != nil {
+			line.Unit_price = *food.Price
+		}
+		line.Amount = line.Unit_price.Times(line.Quantity)
+
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func foodsById(ctx context.Context, orderItems []models.OrderItem) (map[string]models.Food, error) {
+	foodIds := []string{}
+	for _, orderItem := range orderItems {
+		foodIds = append(foodIds, *orderItem.Food_id)
+	}
+
+	result, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var foods []models.Food
+	if err := result.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+
+	byId := make(map[string]models.Food, len(foods))
+	for _, food := range foods {
+		byId[food.Food_id] = food
+	}
+	return byId, nil
+}
+
+func menuCategories(ctx context.Context, foods map[string]models.Food) (map[string]string, error) {
+	menuIds := []string{}
+	for _, food := range foods {
+		if food.Menu_id != nil {
+			menuIds = append(menuIds, *food.Menu_id)
+		}
+	}
+
+	result, err := menuCollection.Find(ctx, bson.M{"menu_id": bson.M{"$in": menuIds}})
+	if err != nil {
+		return nil, err
+	}
+	var menus []models.Menu
+	if err := result.All(ctx, &menus); err != nil {
+		return nil, err
+	}
+
+	categories := make(map[string]string, len(menus))
+	for _, menu := range menus {
+		categories[menu.Menu_id] = menu.Category
+	}
+	return categories, nil
+}
+
+// Keeps the order_items entries of an ItemsByOrder result that are billed on
+// the invoice.
+func invoiceOrderDetails(orderItems interface{}, orderItemIds []string) interface{} {
+	items, ok := orderItems.(primitive.A)
+	if !ok {
+		return orderItems
+	}
+
+	wanted := make(map[string]bool, len(orderItemIds))
+	for _, id := range orderItemIds {
+		wanted[id] = true
+	}
+
+	kept := primitive.A{}
+	for _, item := range items {
+		if doc, ok := item.(primitive.M); ok && wanted[fmt.Sprint(doc["order_item_id"])] {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"golang-restaurant-management/models"
+)
+
+// selectBundleChoices checks a bundle is ordered with one food from each of
+// its slots, each with modifiers that suit it. It returns what the modifiers
+// add to the bundle's price.
+func selectBundleChoices(ctx context.Context, bundle models.Food, choices []models.BundleChoice) ([]models.BundleChoice, models.Money, int, string) {
+	delta := models.NewMoney(0)
+	if len(bundle.Bundle_slots) == 0 {
+		if len(choices) > 0 {
+			return nil, delta, http.StatusBadRequest, *bundle.Name + " is not a bundle"
+		}
+		return nil, delta, 0, ""
+	}
+
+	bySlot := map[string]models.BundleChoice{}
+	for _, choice := range choices {
+		if _, ok := bySlot[choice.Slot_id]; ok {
+			return nil, delta, http.StatusBadRequest, "bundle slot " + choice.Slot_id + " was chosen twice"
+		}
+		bySlot[choice.Slot_id] = choice
+	}
+
+	selected := make([]models.BundleChoice, 0, len(bundle.Bundle_slots))
+	for _, slot := range bundle.Bundle_slots {
+		choice, ok := bySlot[slot.Slot_id]
+		if !ok {
+			return nil, delta, http.StatusBadRequest, "choose a food for " + slot.Name + " in " + *bundle.Name
+		}
+		delete(bySlot, slot.Slot_id)
+
+		offered := false
+		for _, foodId := range slot.Food_ids {
+			offered = offered || foodId == choice.Food_id
+		}
+		if !offered {
+			return nil, delta, http.StatusBadRequest, "food " + choice.Food_id + " is not offered for " + slot.Name
+		}
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": choice.Food_id}).Decode(&food); err != nil {
+			return nil, delta, http.StatusNotFound, "food " + choice.Food_id + " was not found"
+		}
+		if msg := offSaleMessage(food); msg != "" {
+			return nil, delta, http.StatusConflict, msg
+		}
+		modifiers, modifierDelta, msg := selectModifiers(food, choice.Modifiers)
+		if msg != "" {
+			return nil, delta, http.StatusBadRequest, msg
+		}
+
+		delta = delta.Add(modifierDelta)
+		choice.Modifiers = modifiers
+		choice.Order_item_id = ""
+		selected = append(selected, choice)
+	}
+	if len(bySlot) > 0 {
+		return nil, delta, http.StatusBadRequest, "a choice names a slot " + *bundle.Name + " does not have"
+	}
+	return selected, delta, 0, ""
+}
+
+// bundleComponent is the order item the kitchen cooks for one choice in a
+// bundle. The bundle carries the price, so the component is free.
+func bundleComponent(bundle models.OrderItem, choice models.BundleChoice) models.OrderItem {
+	foodId := choice.Food_id
+	quantity := *bundle.Quantity
+	bundleItemId := bundle.Order_item_id
+	unitPrice := models.NewMoney(0)
+	status := models.ItemQueued
+
+	component := models.OrderItem{
+		ID:             primitive.NewObjectID(),
+		Quantity:       &quantity,
+		Unit_price:     &unitPrice,
+		Seat:           bundle.Seat,
+		Created_at:     bundle.Created_at,
+		Updated_at:     bundle.Updated_at,
+		Food_id:        &foodId,
+		Order_id:       bundle.Order_id,
+		Item_status:    &status,
+		Modifiers:      choice.Modifiers,
+		Notes:          choice.Notes,
+		Bundle_item_id: &bundleItemId,
+	}
+	component.Order_item_id = component.ID.Hex()
+	return component
+}
+
+// cancelBundleComponents takes a cancelled bundle's components that have not
+// been cooked off the kitchen's queue.
+func cancelBundleComponents(ctx context.Context, bundleItemId, changedBy string) error {
+	return cancelOrderItems(ctx, bson.M{"bundle_item_id": bundleItemId, "item_status": bson.M{"$in": openKitchenStatuses}}, changedBy)
+}
@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var businessDayCollection *mongo.Collection = database.OpenCollection(database.Client, "businessDay")
+
+const businessDateLayout = "2006-01-02"
+
+type CloseDayRequest struct {
+	Counted_cash  *models.Money `json:"counted_cash"`
+	Opening_float *models.Money `json:"opening_float"`
+	Notes         string        `json:"notes" validate:"max=500"`
+}
+
+func GetBusinessDays(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}}).SetLimit(90)
+	result, err := businessDayCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing business days"})
+	}
+
+	days := []models.BusinessDay{}
+	if err := result.All(ctx, &days); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(days)
+}
+
+// GetBusinessDay returns the Z-report recorded when the day was closed, or,
+// for a day still open, the totals so far.
+func GetBusinessDay(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	date := c.Params("date")
+	from, to, ok := businessDayPeriod(date)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+
+	var day models.BusinessDay
+	err := businessDayCollection.FindOne(ctx, bson.M{"date": date}).Decode(&day)
+	if err == nil {
+		return c.JSON(day)
+	}
+	if err != mongo.ErrNoDocuments {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while fetching the business day"})
+	}
+
+	day, err = zReport(ctx, date, from, to, models.NewMoney(0))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while totalling the business day"})
+	}
+	return c.JSON(day)
+}
+
+// CloseBusinessDay records the day's Z-report along with the cash the
+// cashier counted in the drawer and how far it is from what was expected.
+// Invoices opened in a closed day can no longer be edited.
+func CloseBusinessDay(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	date := c.Params("date")
+	from, to, ok := businessDayPeriod(date)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+	if from.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "business day has not started"})
+	}
+
+	var request CloseDayRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if request.Counted_cash == nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "counted_cash is required"})
+	}
+	openingFloat := models.NewMoney(0)
+	if request.Opening_float != nil {
+		openingFloat = *request.Opening_float
+	}
+	currency := models.DefaultCurrency()
+	if request.Counted_cash.Currency != currency || openingFloat.Currency != currency {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "cash must be counted in " + currency})
+	}
+	if request.Counted_cash.Amount < 0 || openingFloat.Amount < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "cash amounts cannot be negative"})
+	}
+
+	day, err := zReport(ctx, date, from, to, openingFloat)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while totalling the business day"})
+	}
+
+	now := time.Now()
+	variance := request.Counted_cash.Sub(day.Expected_cash)
+	day.ID = primitive.NewObjectID()
+	day.Business_day_id = day.ID.Hex()
+	day.Counted_cash = request.Counted_cash
+	day.Cash_variance = &variance
+	day.Notes = request.Notes
+	day.Closed_by = currentUserId(c)
+	day.Closed_at = &now
+
+	// Only the first close of a day is recorded.
+	opts := options.Update().SetUpsert(true)
+	result, err := businessDayCollection.UpdateOne(ctx, bson.M{"date": date}, bson.D{{Key: "$setOnInsert", Value: day}}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "business day was not closed"})
+	}
+	if result.UpsertedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "business day " + date + " is already closed"})
+	}
+	return c.JSON(day)
+}
+
+// zReport totals the business day. Invoices are priced as they stand now,
+// so refunds show separately rather than reducing the day's sales.
+func zReport(ctx context.Context, date string, from, to time.Time, openingFloat models.Money) (models.BusinessDay, error) {
+	zero := models.NewMoney(0)
+	day := models.BusinessDay{
+		Date:                 date,
+		From:                 from,
+		To:                   to,
+		Subtotal:             zero,
+		Discount_total:       zero,
+		Service_charge_total: zero,
+		Taxes:                []models.TaxTotal{},
+		Tax_total:            zero,
+		Grand_total:          zero,
+		Payments:             []models.TenderTotal{},
+		Payment_total:        zero,
+		Tip_total:            zero,
+		Refunds:              []models.TenderTotal{},
+		Refund_total:         zero,
+		Opening_float:        openingFloat,
+	}
+	inPeriod := bson.M{"$gte": from, "$lt": to}
+
+	var invoices []models.Invoice
+	result, err := invoiceCollection.Find(ctx, bson.M{"created_at": inPeriod})
+	if err != nil {
+		return day, err
+	}
+	if err := result.All(ctx, &invoices); err != nil {
+		return day, err
+	}
+	taxes := map[string]*models.TaxTotal{}
+	var taxNames []string
+	for _, invoice := range invoices {
+		bill, err := invoiceBill(ctx, invoice)
+		if err != nil {
+			return day, err
+		}
+		day.Invoice_count++
+		if invoice.Payment_status == nil || *invoice.Payment_status != models.PaymentPaid {
+			day.Unpaid_invoice_count++
+		}
+		day.Subtotal = day.Subtotal.Add(bill.Subtotal)
+		day.Discount_total = day.Discount_total.Add(bill.Discount_total)
+		day.Service_charge_total = day.Service_charge_total.Add(bill.Service_charge_total)
+		day.Tax_total = day.Tax_total.Add(bill.Tax_total)
+		day.Grand_total = day.Grand_total.Add(bill.Grand_total)
+		for _, line := range bill.Tax_lines {
+			key := line.Name + "|" + strconv.FormatBool(line.Inclusive)
+			if taxes[key] == nil {
+				taxes[key] = &models.TaxTotal{Name: line.Name, Inclusive: line.Inclusive, Amount: zero}
+				taxNames = append(taxNames, key)
+			}
+			taxes[key].Amount = taxes[key].Amount.Add(line.Amount)
+		}
+	}
+	for _, key := range taxNames {
+		day.Taxes = append(day.Taxes, *taxes[key])
+	}
+
+	// Payments count on the day they were taken, whichever day the invoice
+	// was opened.
+	var paidInvoices []models.Invoice
+	result, err = invoiceCollection.Find(ctx, bson.M{"payments.received_at": inPeriod})
+	if err != nil {
+		return day, err
+	}
+	if err := result.All(ctx, &paidInvoices); err != nil {
+		return day, err
+	}
+	payments := map[string]*models.TenderTotal{}
+	for _, invoice := range paidInvoices {
+		for _, payment := range invoice.Payments {
+			if payment.Received_at.Before(from) || !payment.Received_at.Before(to) {
+				continue
+			}
+			total := tenderTotal(payments, payment.Payment_method)
+			total.Count++
+			total.Amount = total.Amount.Add(payment.Amount)
+			total.Tip = total.Tip.Add(payment.Tip)
+			day.Payment_total = day.Payment_total.Add(payment.Amount)
+			day.Tip_total = day.Tip_total.Add(payment.Tip)
+		}
+	}
+	day.Payments = tenderTotals(payments)
+
+	var refunds []models.Refund
+	result, err = refundCollection.Find(ctx, bson.M{"created_at": inPeriod})
+	if err != nil {
+		return day, err
+	}
+	if err := result.All(ctx, &refunds); err != nil {
+		return day, err
+	}
+	refundTotals := map[string]*models.TenderTotal{}
+	for _, refund := range refunds {
+		total := tenderTotal(refundTotals, refund.Payment_method)
+		total.Count++
+		total.Amount = total.Amount.Add(refund.Amount)
+		day.Refund_total = day.Refund_total.Add(refund.Amount)
+	}
+	day.Refunds = tenderTotals(refundTotals)
+
+	// Cash tips stay in the drawer until they are paid out to the servers.
+	day.Expected_cash = openingFloat
+	if cash, ok := payments[models.TenderCash]; ok {
+		day.Expected_cash = day.Expected_cash.Add(cash.Amount).Add(cash.Tip)
+	}
+	if cash, ok := refundTotals[models.TenderCash]; ok {
+		day.Expected_cash = day.Expected_cash.Sub(cash.Amount)
+	}
+	return day, nil
+}
+
+func tenderTotal(totals map[string]*models.TenderTotal, method string) *models.TenderTotal {
+	if totals[method] == nil {
+		totals[method] = &models.TenderTotal{
+			Payment_method: method,
+			Amount:         models.NewMoney(0),
+			Tip:            models.NewMoney(0),
+		}
+	}
+	return totals[method]
+}
+
+func tenderTotals(totals map[string]*models.TenderTotal) []models.TenderTotal {
+	list := []models.TenderTotal{}
+	for _, total := range totals {
+		list = append(list, *total)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Payment_method < list[j].Payment_method
+	})
+	return list
+}
+
+// businessDayPeriod is the span a business date covers. Days start at
+// BUSINESS_DAY_START_HOUR local time, so late service after midnight still
+// counts towards the evening it began in.
+func businessDayPeriod(date string) (time.Time, time.Time, bool) {
+	day, err := time.ParseInLocation(businessDateLayout, date, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	from := day.Add(time.Duration(businessDayStartHour()) * time.Hour)
+	return from, from.AddDate(0, 0, 1), true
+}
+
+func businessDate(t time.Time) string {
+	return t.In(time.Local).Add(-time.Duration(businessDayStartHour()) * time.Hour).Format(businessDateLayout)
+}
+
+func businessDayStartHour() int {
+	hour, err := strconv.Atoi(os.Getenv("BUSINESS_DAY_START_HOUR"))
+	if err != nil || hour < 0 || hour > 23 {
+		return 0
+	}
+	return hour
+}
+
+// businessDayClosed reports whether the business day t falls in has been
+// closed.
+func businessDayClosed(ctx context.Context, t time.Time) (bool, error) {
+	count, err := businessDayCollection.CountDocuments(ctx, bson.M{"date": businessDate(t)})
+	return count > 0, err
+}
@@ -6,7 +6,6 @@ import (
 	"golang-restaurant-management/database"
 	"golang-restaurant-management/models"
 	//"log"
-	"math"
 	"strconv"
 	"time"
 
@@ -43,8 +42,21 @@ func GetFoods(c *fiber.Ctx) error {
 		}
 	}
 
+	match := bson.D{}
+	if activeAt := c.Query("active_at"); activeAt != "" {
+		at, err := time.Parse(time.RFC3339, activeAt)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "active_at must be an RFC 3339 time"})
+		}
+		menuIds, err := activeMenuIds(ctx, at)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing menus"})
+		}
+		match = append(match, bson.E{Key: "menu_id", Value: bson.M{"$in": menuIds}})
+	}
+
 	matchStage := bson.D{
-    {Key: "$match", Value: bson.D{}},
+    {Key: "$match", Value: match},
 }
 
 groupStage := bson.D{
@@ -71,9 +83,12 @@ projectStage := bson.D{
 	}
 
 	var allFoods []bson.M
-	if err := result.All(ctx, &allFoods); err != nil || len(allFoods) == 0 {
+	if err := result.All(ctx, &allFoods); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error decoding food data"})
 	}
+	if len(allFoods) == 0 {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"total_count": 0, "food_items": []bson.M{}})
+	}
 
 	return c.Status(fiber.StatusOK).JSON(allFoods[0])
 }
@@ -114,13 +129,34 @@ func CreateFood(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "menu was not found"})
 	}
 
+	// Recipes are set through their own endpoint, which checks the
+	// ingredients and works out whether the food is held.
+	food.Recipe = nil
+	food.Low_stock_ingredients = nil
+
 	now := time.Now()
 	food.Created_at = now
 	food.Updated_at = now
 	food.ID = primitive.NewObjectID()
 	food.Food_id = food.ID.Hex()
-	num := toFixed(*food.Price, 2)
-	food.Price = &num
+	if msg := checkFoodPrices(food.Price, food.Size_prices); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if food.Modifier_groups == nil {
+		food.Modifier_groups = []models.ModifierGroup{}
+	}
+	if msg := prepareModifierGroups(food.Modifier_groups); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if food.Bundle_slots == nil {
+		food.Bundle_slots = []models.BundleSlot{}
+	}
+	if msg := prepareBundleSlots(ctx, food.Food_id, food.Bundle_slots); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if food.Station_id != nil && !stationExists(ctx, *food.Station_id) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "station was not found"})
+	}
 
 	result, insertErr := foodCollection.InsertOne(ctx, food)
 	if insertErr != nil {
@@ -149,9 +185,18 @@ func UpdateFood(c *fiber.Ctx) error {
 	if food.Name != nil {
 		updateObj = append(updateObj, bson.E{Key: "name", Value: food.Name})
 	}
+	if msg := checkFoodPrices(food.Price, food.Size_prices); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
 	if food.Price != nil {
 		updateObj = append(updateObj, bson.E{Key: "price", Value: food.Price})
 	}
+	if food.Size_prices != nil {
+		if err := validate.Var(food.Size_prices, "dive"); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		updateObj = append(updateObj, bson.E{Key: "size_prices", Value: food.Size_prices})
+	}
 	if food.Food_image != nil {
 		updateObj = append(updateObj, bson.E{Key: "food_image", Value: food.Food_image})
 	}
@@ -160,7 +205,32 @@ func UpdateFood(c *fiber.Ctx) error {
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "menu was not found"})
 		}
-		updateObj = append(updateObj, bson.E{Key: "menu", Value: food.Price})
+		updateObj = append(updateObj, bson.E{Key: "menu_id", Value: food.Menu_id})
+	}
+	if food.Station_id != nil {
+		// An empty station_id sends the food back to the default station.
+		if *food.Station_id != "" && !stationExists(ctx, *food.Station_id) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "station was not found"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "station_id", Value: food.Station_id})
+	}
+	if food.Modifier_groups != nil {
+		if err := validate.Var(food.Modifier_groups, "dive"); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if msg := prepareModifierGroups(food.Modifier_groups); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		updateObj = append(updateObj, bson.E{Key: "modifier_groups", Value: food.Modifier_groups})
+	}
+	if food.Bundle_slots != nil {
+		if err := validate.Var(food.Bundle_slots, "dive"); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if msg := prepareBundleSlots(ctx, foodId, food.Bundle_slots); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		updateObj = append(updateObj, bson.E{Key: "bundle_slots", Value: food.Bundle_slots})
 	}
 
 	food.Updated_at = time.Now()
@@ -169,7 +239,7 @@ func UpdateFood(c *fiber.Ctx) error {
 	upsert := true
 	filter := bson.M{"food_id": foodId}
 	opt := options.UpdateOptions{
-		Upsert: &upsert,g
+		Upsert: &upsert,
 	}
 
 	result, err := foodCollection.UpdateOne(
@@ -185,11 +255,189 @@ func UpdateFood(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
-func round(num float64) int {
-	return int(num + math.Copysign(0.5, num))
+// Totals are summed in the database, so every price has to be in the
+// restaurant's currency, and none of them can be negative.
+func checkFoodPrices(price *models.Money, sizePrices []models.SizePrice) string {
+	currency := models.DefaultCurrency()
+	if price != nil && price.Currency != currency {
+		return "price must be in " + currency
+	}
+	if price != nil && price.Amount < 0 {
+		return "price cannot be negative"
+	}
+	for _, sizePrice := range sizePrices {
+		if sizePrice.Price != nil && sizePrice.Price.Currency != currency {
+			return "size prices must be in " + currency
+		}
+		if sizePrice.Price != nil && sizePrice.Price.Amount < 0 {
+			return "size prices cannot be negative"
+		}
+	}
+	return ""
+}
+
+// The price a line is billed at: the size's own price when the food defines
+// one, the base price when no size was asked for or the food has no sizes.
+func unitPriceFor(food models.Food, size *string) (models.Money, bool) {
+	if size == nil || len(food.Size_prices) == 0 {
+		return *food.Price, true
+	}
+	for _, sizePrice := range food.Size_prices {
+		if sizePrice.Size == *size {
+			return *sizePrice.Price, true
+		}
+	}
+	return models.Money{}, false
 }
 
-func toFixed(num float64, precision int) float64 {
-	output := math.Pow(10, float64(precision))
-	return float64(round(num*output)) / output
+// prepareModifierGroups checks a food's modifier groups and gives new groups
+// and options their ids. Options keep the ids they were sent with, so
+// editing a food does not change what existing order items refer to.
+func prepareModifierGroups(groups []models.ModifierGroup) string {
+	currency := models.DefaultCurrency()
+	groupIds := map[string]bool{}
+	for i := range groups {
+		group := &groups[i]
+		if group.Modifier_group_id == "" {
+			group.Modifier_group_id = primitive.NewObjectID().Hex()
+		}
+		if groupIds[group.Modifier_group_id] {
+			return "modifier group " + group.Modifier_group_id + " is listed twice"
+		}
+		groupIds[group.Modifier_group_id] = true
+		if group.Max_selections > 0 && group.Min_selections > group.Max_selections {
+			return "modifier group " + group.Name + " allows fewer selections than it requires"
+		}
+		if group.Min_selections > len(group.Options) {
+			return "modifier group " + group.Name + " requires more selections than it has options"
+		}
+
+		optionIds := map[string]bool{}
+		for j := range group.Options {
+			option := &group.Options[j]
+			if option.Modifier_id == "" {
+				option.Modifier_id = primitive.NewObjectID().Hex()
+			}
+			if optionIds[option.Modifier_id] {
+				return "modifier " + option.Modifier_id + " is listed twice in " + group.Name
+			}
+			optionIds[option.Modifier_id] = true
+			if option.Price_delta != nil && option.Price_delta.Currency != currency {
+				return "modifier price deltas must be in " + currency
+			}
+		}
+	}
+	return ""
+}
+
+// prepareBundleSlots checks each slot offers foods that exist and are not
+// bundles themselves, and gives new slots their ids. Bundles do not nest, so
+// a food another bundle offers cannot become a bundle.
+func prepareBundleSlots(ctx context.Context, foodId string, slots []models.BundleSlot) string {
+	slotIds := map[string]bool{}
+	foodIds := []string{}
+	seen := map[string]bool{}
+	for i := range slots {
+		slot := &slots[i]
+		if slot.Slot_id == "" {
+			slot.Slot_id = primitive.NewObjectID().Hex()
+		}
+		if slotIds[slot.Slot_id] {
+			return "bundle slot " + slot.Slot_id + " is listed twice"
+		}
+		slotIds[slot.Slot_id] = true
+		for _, foodId := range slot.Food_ids {
+			if !seen[foodId] {
+				seen[foodId] = true
+				foodIds = append(foodIds, foodId)
+			}
+		}
+	}
+	if len(foodIds) == 0 {
+		return ""
+	}
+	if seen[foodId] {
+		return "a bundle cannot offer itself"
+	}
+	if offered, err := foodCollection.CountDocuments(ctx, bson.M{"bundle_slots.food_ids": foodId}); err != nil || offered > 0 {
+		return "food is offered in a bundle, so it cannot be a bundle itself"
+	}
+
+	var foods []models.Food
+	result, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err == nil {
+		err = result.All(ctx, &foods)
+	}
+	if err != nil || len(foods) != len(foodIds) {
+		return "bundle slots offer a food that was not found"
+	}
+	for _, food := range foods {
+		if len(food.Bundle_slots) > 0 {
+			return "bundle slots cannot offer another bundle"
+		}
+	}
+	return ""
+}
+
+// selectModifiers checks the modifiers chosen for an order item against the
+// food's groups and fills in their names and price deltas. It returns what
+// the modifiers add to the price of each unit.
+func selectModifiers(food models.Food, selected []models.OrderItemModifier) ([]models.OrderItemModifier, models.Money, string) {
+	delta := models.NewMoney(0)
+	modifiers := []models.OrderItemModifier{}
+	counts := map[string]int{}
+	chosen := map[string]bool{}
+	for _, selection := range selected {
+		group, option := findModifier(food, selection.Modifier_group_id, selection.Modifier_id)
+		if option == nil {
+			return nil, delta, "modifier " + selection.Modifier_id + " is not offered for " + *food.Name
+		}
+		if chosen[group.Modifier_group_id+"|"+option.Modifier_id] {
+			return nil, delta, option.Name + " was chosen twice"
+		}
+		chosen[group.Modifier_group_id+"|"+option.Modifier_id] = true
+		counts[group.Modifier_group_id]++
+
+		modifier := models.OrderItemModifier{
+			Modifier_group_id: group.Modifier_group_id,
+			Modifier_id:       option.Modifier_id,
+			Name:              option.Name,
+			Price_delta:       models.NewMoney(0),
+		}
+		if option.Price_delta != nil {
+			modifier.Price_delta = *option.Price_delta
+		}
+		delta = delta.Add(modifier.Price_delta)
+		modifiers = append(modifiers, modifier)
+	}
+
+	for _, group := range food.Modifier_groups {
+		min := group.Min_selections
+		if group.Required && min < 1 {
+			min = 1
+		}
+		count := counts[group.Modifier_group_id]
+		if count < min {
+			return nil, delta, group.Name + " needs at least " + strconv.Itoa(min) + " selection(s)"
+		}
+		if group.Max_selections > 0 && count > group.Max_selections {
+			return nil, delta, group.Name + " allows at most " + strconv.Itoa(group.Max_selections) + " selection(s)"
+		}
+	}
+	return modifiers, delta, ""
+}
+
+func findModifier(food models.Food, groupId, modifierId string) (*models.ModifierGroup, *models.Modifier) {
+	for i := range food.Modifier_groups {
+		group := &food.Modifier_groups[i]
+		if group.Modifier_group_id != groupId {
+			continue
+		}
+		for j := range group.Options {
+			if group.Options[j].Modifier_id == modifierId {
+				return group, &group.Options[j]
+			}
+		}
+	}
+	return nil, nil
 }
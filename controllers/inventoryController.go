@@ -0,0 +1,478 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/events"
+	"golang-restaurant-management/models"
+)
+
+var ingredientCollection *mongo.Collection = database.OpenCollection(database.Client, "ingredient")
+var stockMovementCollection *mongo.Collection = database.OpenCollection(database.Client, "stockMovement")
+
+const inventoryTopic = "inventory"
+
+type StockAdjustment struct {
+	Reason string   `json:"reason" validate:"required,eq=ADJUSTMENT|eq=WASTE|eq=COUNT"`
+	Change *float64 `json:"change"`
+	Stock  *float64 `json:"stock"`
+	Note   string   `json:"note" validate:"max=200"`
+}
+
+type RecipeRequest struct {
+	Recipe []models.RecipeLine `json:"recipe" validate:"dive"`
+}
+
+func GetIngredients(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if c.Query("low_stock") == "true" {
+		filter["low_stock"] = true
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	result, err := ingredientCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing ingredients"})
+	}
+
+	ingredients := []models.Ingredient{}
+	if err := result.All(ctx, &ingredients); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(ingredients)
+}
+
+func GetIngredient(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var ingredient models.Ingredient
+	err := ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": c.Params("ingredient_id")}).Decode(&ingredient)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "ingredient was not found"})
+	}
+	return c.JSON(ingredient)
+}
+
+// CreateIngredient adds an ingredient. Its opening stock is recorded as a
+// stock count.
+func CreateIngredient(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var ingredient models.Ingredient
+	if err := c.BodyParser(&ingredient); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(ingredient); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if ingredient.Stock < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "stock cannot be negative"})
+	}
+	if ingredient.Hold_foods == nil {
+		hold := false
+		ingredient.Hold_foods = &hold
+	}
+	openingStock := ingredient.Stock
+
+	now := time.Now()
+	ingredient.ID = primitive.NewObjectID()
+	ingredient.Ingredient_id = ingredient.ID.Hex()
+	ingredient.Stock = 0
+	ingredient.Low_stock = false
+	ingredient.Created_at = now
+	ingredient.Updated_at = now
+
+	if _, err := ingredientCollection.InsertOne(ctx, ingredient); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "ingredient was not created"})
+	}
+
+	movement := models.StockMovement{Reason: models.StockCount, Note: "opening stock", Created_by: currentUserId(c)}
+	ingredient, err := changeStock(ctx, ingredient.Ingredient_id, openingStock, movement)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "opening stock was not recorded"})
+	}
+	return c.JSON(ingredient)
+}
+
+// UpdateIngredient changes an ingredient's details. Stock only changes
+// through adjustments and orders, so it has a movement behind it.
+func UpdateIngredient(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var ingredient models.Ingredient
+	if err := c.BodyParser(&ingredient); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var updateObj primitive.D
+	if ingredient.Name != nil {
+		if err := validate.Var(*ingredient.Name, "min=2,max=100"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name must be 2 to 100 characters"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "name", Value: *ingredient.Name})
+	}
+	if ingredient.Unit != nil {
+		if err := validate.Var(*ingredient.Unit, "min=1,max=16"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unit must be 1 to 16 characters"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "unit", Value: *ingredient.Unit})
+	}
+	if ingredient.Reorder_level != nil {
+		if *ingredient.Reorder_level < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "reorder_level cannot be negative"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "reorder_level", Value: *ingredient.Reorder_level})
+	}
+	if ingredient.Hold_foods != nil {
+		updateObj = append(updateObj, bson.E{Key: "hold_foods", Value: *ingredient.Hold_foods})
+	}
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: time.Now()})
+
+	var updated models.Ingredient
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := ingredientCollection.FindOneAndUpdate(ctx,
+		bson.M{"ingredient_id": c.Params("ingredient_id")},
+		bson.D{{Key: "$set", Value: updateObj}},
+		opts,
+	).Decode(&updated)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "ingredient was not found"})
+	}
+
+	// A new reorder level or hold setting can change whether the ingredient
+	// is low and which foods it holds.
+	updated, err = updateLowStock(ctx, updated)
+	if err == nil && ingredient.Hold_foods != nil {
+		err = syncHeldFoods(ctx, updated)
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "unable to update low stock"})
+	}
+	return c.JSON(updated)
+}
+
+// AdjustStock records a delivery, correction or waste as a change, or a
+// stock count as the stock now on the shelf.
+func AdjustStock(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var adjustment StockAdjustment
+	if err := c.BodyParser(&adjustment); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(adjustment); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ingredientId := c.Params("ingredient_id")
+	var ingredient models.Ingredient
+	if err := ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": ingredientId}).Decode(&ingredient); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "ingredient was not found"})
+	}
+
+	var change float64
+	switch {
+	case adjustment.Reason == models.StockCount:
+		if adjustment.Stock == nil || *adjustment.Stock < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "a stock count needs the stock counted"})
+		}
+		change = *adjustment.Stock - ingredient.Stock
+	case adjustment.Change == nil || *adjustment.Change == 0:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "change is required"})
+	case adjustment.Reason == models.StockWaste && *adjustment.Change > 0:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "waste must reduce stock"})
+	default:
+		change = *adjustment.Change
+	}
+
+	movement := models.StockMovement{Reason: adjustment.Reason, Note: adjustment.Note, Created_by: currentUserId(c)}
+	ingredient, err := changeStock(ctx, ingredientId, change, movement)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "stock was not adjusted"})
+	}
+	return c.JSON(ingredient)
+}
+
+func GetStockMovements(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(200)
+	result, err := stockMovementCollection.Find(ctx, bson.M{"ingredient_id": c.Params("ingredient_id")}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing stock movements"})
+	}
+
+	movements := []models.StockMovement{}
+	if err := result.All(ctx, &movements); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(movements)
+}
+
+// InventoryFeed streams low_stock and stock_recovered alerts.
+func InventoryFeed(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	feed, unsubscribe := events.Subscribe(inventoryTopic)
+
+	var low []models.Ingredient
+	result, err := ingredientCollection.Find(ctx, bson.M{"low_stock": true})
+	if err == nil {
+		err = result.All(ctx, &low)
+	}
+	if err != nil {
+		unsubscribe()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing low stock"})
+	}
+
+	return events.Stream(c, feed, unsubscribe, events.Event{Type: "snapshot", Data: low})
+}
+
+// SetRecipe replaces what one portion of a food uses. Orders already taken
+// keep the stock they used.
+func SetRecipe(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request RecipeRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ingredientIds := []string{}
+	seen := map[string]bool{}
+	for _, line := range request.Recipe {
+		if seen[line.Ingredient_id] {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "ingredient " + line.Ingredient_id + " is listed twice"})
+		}
+		seen[line.Ingredient_id] = true
+		ingredientIds = append(ingredientIds, line.Ingredient_id)
+	}
+
+	var ingredients []models.Ingredient
+	result, err := ingredientCollection.Find(ctx, bson.M{"ingredient_id": bson.M{"$in": ingredientIds}})
+	if err == nil {
+		err = result.All(ctx, &ingredients)
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while fetching ingredients"})
+	}
+	if len(ingredients) != len(ingredientIds) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "recipe uses an ingredient that was not found"})
+	}
+
+	held := []string{}
+	for _, ingredient := range ingredients {
+		if ingredient.Low_stock && ingredient.Hold_foods != nil && *ingredient.Hold_foods {
+			held = append(held, ingredient.Ingredient_id)
+		}
+	}
+	if request.Recipe == nil {
+		request.Recipe = []models.RecipeLine{}
+	}
+
+	var food models.Food
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = foodCollection.FindOneAndUpdate(ctx,
+		bson.M{"food_id": c.Params("food_id")},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "recipe", Value: request.Recipe},
+			{Key: "low_stock_ingredients", Value: held},
+			{Key: "updated_at", Value: time.Now()},
+		}}},
+		opts,
+	).Decode(&food)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "food was not found"})
+	}
+	events.Publish(availabilityTopic, events.Event{Type: "availability", Data: []FoodAvailability{foodAvailability(food)}})
+	return c.JSON(food)
+}
+
+// changeStock moves an ingredient's stock by change, records the movement
+// and raises or clears its low stock alert.
+func changeStock(ctx context.Context, ingredientId string, change float64, movement models.StockMovement) (models.Ingredient, error) {
+	now := time.Now()
+	var ingredient models.Ingredient
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := ingredientCollection.FindOneAndUpdate(ctx,
+		bson.M{"ingredient_id": ingredientId},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "stock", Value: change}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}},
+		},
+		opts,
+	).Decode(&ingredient)
+	if err != nil {
+		return ingredient, err
+	}
+
+	movement.ID = primitive.NewObjectID()
+	movement.Stock_movement_id = movement.ID.Hex()
+	movement.Ingredient_id = ingredientId
+	movement.Change = change
+	movement.Stock = ingredient.Stock
+	movement.Created_at = now
+	if _, err := stockMovementCollection.InsertOne(ctx, movement); err != nil {
+		return ingredient, err
+	}
+
+	return updateLowStock(ctx, ingredient)
+}
+
+// updateLowStock flags the ingredient once it falls below its reorder level
+// and clears the flag once it is back above it. Only the change that flips
+// the flag raises the alert, so concurrent orders alert once.
+func updateLowStock(ctx context.Context, ingredient models.Ingredient) (models.Ingredient, error) {
+	low := ingredient.Reorder_level != nil && ingredient.Stock < *ingredient.Reorder_level
+	if low == ingredient.Low_stock {
+		return ingredient, nil
+	}
+
+	result, err := ingredientCollection.UpdateOne(ctx,
+		bson.M{"ingredient_id": ingredient.Ingredient_id, "low_stock": !low},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "low_stock", Value: low}}}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		return ingredient, err
+	}
+	ingredient.Low_stock = low
+
+	if err := syncHeldFoods(ctx, ingredient); err != nil {
+		return ingredient, err
+	}
+
+	eventType := "stock_recovered"
+	if low {
+		eventType = "low_stock"
+		log.Printf("inventory: %s is low, %g %s left", *ingredient.Name, ingredient.Stock, *ingredient.Unit)
+	}
+	events.Publish(inventoryTopic, events.Event{Type: eventType, Data: ingredient})
+	return ingredient, nil
+}
+
+// syncHeldFoods takes the foods using the ingredient off sale while it is
+// low and set to hold them, and puts them back otherwise.
+func syncHeldFoods(ctx context.Context, ingredient models.Ingredient) error {
+	filter := bson.M{"recipe.ingredient_id": ingredient.Ingredient_id}
+	op := "$pull"
+	if ingredient.Low_stock && ingredient.Hold_foods != nil && *ingredient.Hold_foods {
+		op = "$addToSet"
+	}
+	result, err := foodCollection.UpdateMany(ctx, filter, bson.D{
+		{Key: op, Value: bson.D{{Key: "low_stock_ingredients", Value: ingredient.Ingredient_id}}},
+	})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		publishAvailability(ctx, filter)
+	}
+	return nil
+}
+
+// itemStockChange is an order item before and after a change; before is nil
+// for a new item.
+type itemStockChange struct {
+	before *models.OrderItem
+	after  *models.OrderItem
+}
+
+// updateItemStock takes the ingredients order items use out of stock, and
+// puts back what cancelled items no longer use. Voided items were still
+// made, so they keep theirs. The items are already saved, so stock that
+// cannot be moved is logged rather than failing the request.
+func updateItemStock(ctx context.Context, changedBy string, changes ...itemStockChange) {
+	foodIds := []string{}
+	for _, change := range changes {
+		for _, item := range []*models.OrderItem{change.before, change.after} {
+			if item != nil && item.Food_id != nil {
+				foodIds = append(foodIds, *item.Food_id)
+			}
+		}
+	}
+
+	var foods []models.Food
+	result, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}, "recipe.0": bson.M{"$exists": true}})
+	if err == nil {
+		err = result.All(ctx, &foods)
+	}
+	if err != nil {
+		log.Printf("inventory: recipes were not loaded: %v", err)
+		return
+	}
+	if len(foods) == 0 {
+		return
+	}
+	recipes := map[string][]models.RecipeLine{}
+	for _, food := range foods {
+		recipes[food.Food_id] = food.Recipe
+	}
+
+	for _, change := range changes {
+		orderItem := change.after
+		if orderItem == nil {
+			orderItem = change.before
+		}
+		used := stockUsed(recipes, change.after)
+		for ingredientId, quantity := range stockUsed(recipes, change.before) {
+			used[ingredientId] -= quantity
+		}
+
+		for ingredientId, quantity := range used {
+			if quantity == 0 {
+				continue
+			}
+			movement := models.StockMovement{
+				Reason:        models.StockOrdered,
+				Order_id:      orderItem.Order_id,
+				Order_item_id: orderItem.Order_item_id,
+				Created_by:    changedBy,
+			}
+			if quantity < 0 {
+				movement.Reason = models.StockCancelled
+			}
+			if _, err := changeStock(ctx, ingredientId, -quantity, movement); err != nil {
+				log.Printf("inventory: stock for order item %s was not moved: %v", orderItem.Order_item_id, err)
+			}
+		}
+	}
+}
+
+// stockUsed is what an order item takes out of stock, by ingredient.
+func stockUsed(recipes map[string][]models.RecipeLine, item *models.OrderItem) map[string]float64 {
+	used := map[string]float64{}
+	if item == nil || item.Food_id == nil || item.Quantity == nil {
+		return used
+	}
+	if item.Item_status != nil && *item.Item_status == models.ItemCancelled {
+		return used
+	}
+	for _, line := range recipes[*item.Food_id] {
+		used[line.Ingredient_id] += line.Quantity * float64(*item.Quantity)
+	}
+	return used
+}
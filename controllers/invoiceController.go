@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"golang-restaurant-management/database"
+	helper "golang-restaurant-management/helpers"
 	"golang-restaurant-management/models"
 	"log"
 	"time"
@@ -16,14 +17,32 @@ import (
 )
 
 type InvoiceViewFormat struct {
-	Invoice_id       string      `json:"invoice_id"`
-	Payment_method   string      `json:"payment_method"`
-	Order_id         string      `json:"order_id"`
-	Payment_status   *string     `json:"payment_status"`
-	Payment_due      interface{} `json:"payment_due"`
-	Table_number     interface{} `json:"table_number"`
-	Payment_due_date time.Time   `json:"payment_due_date"`
-	Order_details    interface{} `json:"order_details"`
+	Invoice_id           string                     `json:"invoice_id"`
+	Payment_method       string                     `json:"payment_method"`
+	Order_id             string                     `json:"order_id"`
+	Payment_status       *string                    `json:"payment_status"`
+	Subtotal             models.Money               `json:"subtotal"`
+	Discount_lines       []helper.DiscountLine      `json:"discount_lines"`
+	Discount_total       models.Money               `json:"discount_total"`
+	Tax_lines            []helper.TaxLine           `json:"tax_lines"`
+	Tax_total            models.Money               `json:"tax_total"`
+	Grand_total          models.Money               `json:"grand_total"`
+	Payment_due          models.Money               `json:"payment_due"`
+	Service_charges      []helper.ServiceChargeLine `json:"service_charges"`
+	Service_charge_total models.Money               `json:"service_charge_total"`
+	Payments             []models.Payment           `json:"payments"`
+	Amount_paid          models.Money               `json:"amount_paid"`
+	Failed_payments      []models.PaymentFailure    `json:"failed_payments"`
+	Refunds              []models.Refund            `json:"refunds"`
+	Refund_total         models.Money               `json:"refund_total"`
+	Tip_total            models.Money               `json:"tip_total"`
+	Balance_due          models.Money               `json:"balance_due"`
+	Order_item_ids       []string                   `json:"order_item_ids"`
+	Split_part           *int                       `json:"split_part"`
+	Split_of             *int                       `json:"split_of"`
+	Table_number         interface{}                `json:"table_number"`
+	Payment_due_date     time.Time                  `json:"payment_due_date"`
+	Order_details        interface{}                `json:"order_details"`
 }
 
 var invoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "invoice")
@@ -57,10 +76,21 @@ func GetInvoice(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing invoice item"})
 	}
 
+	invoiceView, status, msg := invoiceViewFor(ctx, invoice)
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(invoiceView)
+}
+
+// invoiceViewFor prices the invoice and gathers its order items, payments
+// and refunds, as shown by GetInvoice and printed on receipts.
+func invoiceViewFor(ctx context.Context, invoice models.Invoice) (InvoiceViewFormat, int, string) {
 	var invoiceView InvoiceViewFormat
 	allOrderItems, err := ItemsByOrder(invoice.Order_id)
 	if err != nil || len(allOrderItems) == 0 {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "unable to fetch order items"})
+		return invoiceView, fiber.StatusInternalServerError, "unable to fetch order items"
 	}
 
 	invoiceView.Order_id = invoice.Order_id
@@ -71,11 +101,42 @@ func GetInvoice(c *fiber.Ctx) error {
 	}
 	invoiceView.Invoice_id = invoice.Invoice_id
 	invoiceView.Payment_status = invoice.Payment_status
-	invoiceView.Payment_due = allOrderItems[0]["payment_due"]
+	bill, err := invoiceBill(ctx, invoice)
+	if err != nil {
+		return invoiceView, fiber.StatusInternalServerError, "unable to price the invoice"
+	}
+	invoiceView.Subtotal = bill.Subtotal
+	invoiceView.Discount_lines = bill.Discount_lines
+	invoiceView.Discount_total = bill.Discount_total
+	invoiceView.Tax_lines = bill.Tax_lines
+	invoiceView.Tax_total = bill.Tax_total
+	invoiceView.Grand_total = bill.Grand_total
+	invoiceView.Payment_due = bill.Grand_total
+	invoiceView.Service_charges = bill.Service_charges
+	invoiceView.Service_charge_total = bill.Service_charge_total
+	invoiceView.Payments = invoice.Payments
+	invoiceView.Amount_paid = amountPaid(invoice)
+	invoiceView.Failed_payments = invoice.Failed_payments
+	invoiceView.Refunds, err = invoiceRefunds(ctx, invoice.Invoice_id)
+	if err != nil {
+		return invoiceView, fiber.StatusInternalServerError, "unable to fetch refunds"
+	}
+	invoiceView.Refund_total = models.NewMoney(0)
+	for _, refund := range invoiceView.Refunds {
+		invoiceView.Refund_total = invoiceView.Refund_total.Add(refund.Amount)
+	}
+	invoiceView.Tip_total = tipsPaid(invoice)
+	invoiceView.Balance_due = bill.Grand_total.Sub(invoiceView.Amount_paid)
+	invoiceView.Order_item_ids = invoice.Order_item_ids
+	invoiceView.Split_part = invoice.Split_part
+	invoiceView.Split_of = invoice.Split_of
 	invoiceView.Table_number = allOrderItems[0]["table_number"]
 	invoiceView.Order_details = allOrderItems[0]["order_items"]
+	if invoice.Order_item_ids != nil {
+		invoiceView.Order_details = invoiceOrderDetails(allOrderItems[0]["order_items"], invoice.Order_item_ids)
+	}
 
-	return c.Status(fiber.StatusOK).JSON(invoiceView)
+	return invoiceView, fiber.StatusOK, ""
 }
 
 func CreateInvoice(c *fiber.Ctx) error {
@@ -94,12 +155,39 @@ func CreateInvoice(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": msg})
 	}
 
-	status := "PENDING"
-	if invoice.Payment_status == nil {
-		invoice.Payment_status = &status
+	if orderStatus(order) != models.OrderServed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "only served orders can be invoiced, order is " + orderStatus(order)})
+	}
+
+	existing, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": invoice.Order_id})
+	if err != nil || existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "order already has invoices"})
+	}
+
+	// Discounts, payments and splits go through their own endpoints so they
+	// are checked and audited.
+	invoice.Discounts = nil
+	invoice.Payments = nil
+	invoice.Order_item_ids = nil
+	invoice.Split_part = nil
+	invoice.Split_of = nil
+
+	invoice.Service_charge, err = serviceChargeFor(ctx, order)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "unable to look up service charges"})
 	}
 
+	status := models.PaymentPending
+	invoice.Payment_status = &status
+
 	now := time.Now()
+	closed, err := businessDayClosed(ctx, now)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while checking the business day"})
+	}
+	if closed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "business day " + businessDate(now) + " is closed"})
+	}
 	invoice.Payment_due_date = now.AddDate(0, 0, 1)
 	invoice.Created_at = now
 	invoice.Updated_at = now
@@ -133,11 +221,63 @@ func UpdateInvoice(c *fiber.Ctx) error {
 	filter := bson.M{"invoice_id": invoiceId}
 	var updateObj primitive.D
 
-	if invoice.Payment_method != nil {
-		updateObj = append(updateObj, bson.E{Key: "payment_method", Value: invoice.Payment_method})
+	// Closed days have been reconciled against the drawer, so their
+	// invoices stay as they were reported.
+	var current models.Invoice
+	openedAt := time.Now()
+	if err := invoiceCollection.FindOne(ctx, filter).Decode(&current); err == nil {
+		openedAt = current.Created_at
+	}
+	closed, err := businessDayClosed(ctx, openedAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while checking the business day"})
 	}
+	if closed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "business day " + businessDate(openedAt) + " is closed"})
+	}
+
+	// The status follows the recorded payments; marking an invoice PAID
+	// records a payment for whatever is still owed, charging the card given
+	// by card_token when it is paid by card.
 	if invoice.Payment_status != nil {
-		updateObj = append(updateObj, bson.E{Key: "payment_status", Value: invoice.Payment_status})
+		if *invoice.Payment_status != models.PaymentPaid {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "payment_status follows the recorded payments and can only be set to PAID"})
+		}
+
+		method := invoice.Payment_method
+		if method == nil {
+			var storedInvoice models.Invoice
+			if err := invoiceCollection.FindOne(ctx, filter).Decode(&storedInvoice); err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "invoice was not found"})
+			}
+			method = storedInvoice.Payment_method
+		}
+		if method == nil || *method == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "payment_method is required to settle an invoice"})
+		}
+		if err := validate.Var(*method, "eq=CARD|eq=CASH"); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "payment_method must be CARD or CASH"})
+		}
+
+		var card struct {
+			Card_token *string `json:"card_token"`
+		}
+		if err := c.BodyParser(&card); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		request := PaymentRequest{Payment_method: method, Card_token: card.Card_token}
+		settled, _, status, msg := recordPayment(ctx, invoiceId, request, currentUserId(c))
+		if msg != "" {
+			return c.Status(status).JSON(fiber.Map{"error": msg})
+		}
+		if err := settleOrder(ctx, settled.Order_id, currentUserId(c)); err != nil {
+			return orderTransitionError(c, err)
+		}
+	}
+
+	if invoice.Payment_method != nil {
+		updateObj = append(updateObj, bson.E{Key: "payment_method", Value: invoice.Payment_method})
 	}
 
 	invoice.Updated_at = time.Now()
@@ -160,4 +300,20 @@ func UpdateInvoice(c *fiber.Ctx) error {
 	}
 
 	return c.Status(fiber.StatusOK).JSON(result)
-}
\ No newline at end of file
+}
+
+func pushInvoiceEntry(ctx context.Context, invoiceId, field string, entry interface{}) error {
+	// Invoices created before the field existed store null here, which $push rejects.
+	_, err := invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoiceId, field: nil}, bson.D{
+		{Key: "$set", Value: bson.M{field: bson.A{}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoiceId}, bson.D{
+		{Key: "$push", Value: bson.M{field: entry}},
+		{Key: "$set", Value: bson.M{"updated_at": time.Now()}},
+	})
+	return err
+}
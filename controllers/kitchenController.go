@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/events"
+	"golang-restaurant-management/models"
+)
+
+const kitchenTopic = "kitchen"
+
+var openKitchenStatuses = []string{models.ItemQueued, models.ItemStarted}
+
+func GetKitchenTickets(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	tickets, err := kitchenTickets(ctx, bson.D{{Key: "item_status", Value: bson.M{"$in": openKitchenStatuses}}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing kitchen tickets"})
+	}
+	return c.JSON(tickets)
+}
+
+func KitchenFeed(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	feed, unsubscribe := events.Subscribe(kitchenTopic)
+
+	tickets, err := kitchenTickets(ctx, bson.D{{Key: "item_status", Value: bson.M{"$in": openKitchenStatuses}}})
+	if err != nil {
+		unsubscribe()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing kitchen tickets"})
+	}
+
+	return events.Stream(c, feed, unsubscribe, events.Event{Type: "snapshot", Data: tickets})
+}
+
+func AcknowledgeOrderItem(c *fiber.Ctx) error {
+	return moveKitchenItem(c, models.ItemStarted)
+}
+
+func BumpOrderItem(c *fiber.Ctx) error {
+	return moveKitchenItem(c, models.ItemReady)
+}
+
+func moveKitchenItem(c *fiber.Ctx, to string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	orderItemId := c.Params("order_item_id")
+	var orderItem models.OrderItem
+	if err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "order item was not found"})
+	}
+
+	from := models.ItemQueued
+	if orderItem.Item_status != nil {
+		from = *orderItem.Item_status
+	}
+	if from == models.ItemCancelled || from == models.ItemVoided || from == models.ItemReady || from == to {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "order item is already " + from})
+	}
+
+	now := time.Now()
+	updateObj := bson.D{
+		{Key: "item_status", Value: to},
+		{Key: "updated_at", Value: now},
+	}
+	if to == models.ItemStarted {
+		updateObj = append(updateObj, bson.E{Key: "started_at", Value: now})
+	} else {
+		updateObj = append(updateObj, bson.E{Key: "ready_at", Value: now})
+	}
+
+	// Match on the status we checked so a bump cannot land on an item that
+	// was cancelled in the meantime.
+	filter := bson.M{"order_item_id": orderItemId, "item_status": orderItem.Item_status}
+	result, err := orderItemCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "order item update failed"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "order item changed, try again"})
+	}
+
+	if err := syncOrderWithKitchen(ctx, orderItem.Order_id, currentUserId(c)); err != nil {
+		return orderTransitionError(c, err)
+	}
+
+	publishKitchenEvent(ctx, "item_status", []string{orderItemId})
+	return c.JSON(fiber.Map{"order_item_id": orderItemId, "item_status": to})
+}
+
+// The first acknowledged item moves the order into the kitchen and the last
+// bumped one marks it ready for service.
+func syncOrderWithKitchen(ctx context.Context, orderId, changedBy string) error {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+		return errOrderNotFound
+	}
+
+	switch orderStatus(order) {
+	case models.OrderPlaced:
+		_, err := transitionOrder(ctx, orderId, models.OrderInKitchen, changedBy)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case models.OrderInKitchen:
+		open, err := orderItemCollection.CountDocuments(ctx, bson.M{
+			"order_id":    orderId,
+			"item_status": bson.M{"$in": openKitchenStatuses},
+		})
+		if err != nil {
+			return err
+		}
+		if open == 0 {
+			_, err = transitionOrder(ctx, orderId, models.OrderReady, changedBy)
+			return err
+		}
+	}
+	return nil
+}
+
+func cancelOpenOrderItems(ctx context.Context, orderId, changedBy string) error {
+	return cancelOrderItems(ctx, bson.M{"order_id": orderId, "item_status": bson.M{"$in": openKitchenStatuses}}, changedBy)
+}
+
+// cancelOrderItems cancels the order items the filter matches, tells the
+// kitchen and puts back the stock they used. Each item is flipped on its own
+// while it is still open, and only the items this call flipped give their
+// stock back, so a racing bump or cancel cannot return it twice.
+func cancelOrderItems(ctx context.Context, filter bson.M, changedBy string) error {
+	var candidates []models.OrderItem
+	result, err := orderItemCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if err := result.All(ctx, &candidates); err != nil {
+		return err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "item_status", Value: models.ItemCancelled},
+		{Key: "updated_at", Value: time.Now()},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	cancelled := make([]models.OrderItem, 0, len(candidates))
+	for _, candidate := range candidates {
+		var orderItem models.OrderItem
+		open := bson.M{"order_item_id": candidate.Order_item_id, "item_status": bson.M{"$in": openKitchenStatuses}}
+		err := orderItemCollection.FindOneAndUpdate(ctx, open, update, opts).Decode(&orderItem)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		cancelled = append(cancelled, orderItem)
+	}
+	if len(cancelled) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(cancelled))
+	stockChanges := make([]itemStockChange, 0, len(cancelled))
+	for i, orderItem := range cancelled {
+		ids = append(ids, orderItem.Order_item_id)
+		stockChanges = append(stockChanges, itemStockChange{before: &cancelled[i]})
+	}
+	publishKitchenEvent(ctx, "item_cancelled", ids)
+	updateItemStock(ctx, changedBy, stockChanges...)
+	_, freed := foodCountChanges(stockChanges...)
+	releaseFoods(ctx, freed)
+	return nil
+}
+
+// Kitchen events carry the affected items as tickets, the same shape as the
+// snapshot, so screens can merge them without another request.
+func publishKitchenEvent(ctx context.Context, eventType string, orderItemIds []string) {
+	tickets, err := kitchenTickets(ctx, bson.D{{Key: "order_item_id", Value: bson.M{"$in": orderItemIds}}})
+	if err != nil {
+		return
+	}
+	events.Publish(kitchenTopic, events.Event{Type: eventType, Data: tickets})
+}
+
+func kitchenTickets(ctx context.Context, match bson.D) ([]bson.M, error) {
+	matchStage := bson.D{{Key: "$match", Value: match}}
+	sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}}
+	lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "food"},
+		{Key: "localField", Value: "food_id"},
+		{Key: "foreignField", Value: "food_id"},
+		{Key: "as", Value: "food"},
+	}}}
+	unwindFoodStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$food"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "order"},
+		{Key: "localField", Value: "order_id"},
+		{Key: "foreignField", Value: "order_id"},
+		{Key: "as", Value: "order"},
+	}}}
+	unwindOrderStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$order"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "table"},
+		{Key: "localField", Value: "order.table_id"},
+		{Key: "foreignField", Value: "table_id"},
+		{Key: "as", Value: "table"},
+	}}}
+	unwindTableStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$table"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: "$order_id"},
+		{Key: "table_id", Value: bson.D{{Key: "$first", Value: "$order.table_id"}}},
+		{Key: "table_number", Value: bson.D{{Key: "$first", Value: "$table.table_number"}}},
+		{Key: "order_status", Value: bson.D{{Key: "$first", Value: "$order.order_status"}}},
+		{Key: "opened_at", Value: bson.D{{Key: "$min", Value: "$created_at"}}},
+		{Key: "items", Value: bson.D{{Key: "$push", Value: bson.D{
+			{Key: "order_item_id", Value: "$order_item_id"},
+			{Key: "food_id", Value: "$food_id"},
+			{Key: "food_name", Value: "$food.name"},
+			{Key: "quantity", Value: "$quantity"},
+			{Key: "size", Value: "$size"},
+			{Key: "modifiers", Value: "$modifiers.name"},
+			{Key: "notes", Value: "$notes"},
+			{Key: "item_status", Value: "$item_status"},
+			{Key: "created_at", Value: "$created_at"},
+			{Key: "started_at", Value: "$started_at"},
+			{Key: "ready_at", Value: "$ready_at"},
+		}}}},
+	}}}
+
+	projectStage := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "order_id", Value: "$_id"},
+		{Key: "table_id", Value: 1},
+		{Key: "table_number", Value: 1},
+		{Key: "order_status", Value: 1},
+		{Key: "opened_at", Value: 1},
+		{Key: "items", Value: 1},
+	}}}
+	sortTicketsStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "opened_at", Value: 1}}}}
+
+	result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+		matchStage,
+		sortStage,
+		lookupFoodStage,
+		unwindFoodStage,
+		lookupOrderStage,
+		unwindOrderStage,
+		lookupTableStage,
+		unwindTableStage,
+		groupStage,
+		projectStage,
+		sortTicketsStage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := []bson.M{}
+	err = result.All(ctx, &tickets)
+	return tickets, err
+}
@@ -21,7 +21,20 @@ func GetMenus(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
 
-	result, err := menuCollection.Find(ctx, bson.M{})
+	filter := bson.M{}
+	if activeAt := c.Query("active_at"); activeAt != "" {
+		at, err := time.Parse(time.RFC3339, activeAt)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "active_at must be an RFC 3339 time"})
+		}
+		menuIds, err := activeMenuIds(ctx, at)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing the menu items"})
+		}
+		filter["menu_id"] = bson.M{"$in": menuIds}
+	}
+
+	result, err := menuCollection.Find(ctx, filter)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing the menu items"})
 	}
@@ -62,6 +75,12 @@ func CreateMenu(c *fiber.Ctx) error {
 	if validationErr := validate.Struct(menu); validationErr != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": validationErr.Error()})
 	}
+	if menu.Start_Date != nil && menu.End_Date != nil && !menu.End_Date.After(*menu.Start_Date) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "end_date must be after start_date"})
+	}
+	if msg := checkDayparts(menu.Dayparts); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
 
 	menu.Created_at = time.Now()
 	menu.Updated_at = time.Now()
@@ -77,7 +96,7 @@ func CreateMenu(c *fiber.Ctx) error {
 }
 
 func inTimeSpan(start, end, check time.Time) bool {
-	return start.After(time.Now()) && end.After(start)
+	return !check.Before(start) && check.Before(end)
 }
 
 func UpdateMenu(c *fiber.Ctx) error {
@@ -93,13 +112,33 @@ func UpdateMenu(c *fiber.Ctx) error {
 	filter := bson.M{"menu_id": menuId}
 	var updateObj primitive.D
 
-	if menu.Start_Date != nil && menu.End_Date != nil {
-		if !inTimeSpan(*menu.Start_Date, *menu.End_Date, time.Now()) {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "kindly retype the time"})
+	if menu.Start_Date != nil || menu.End_Date != nil {
+		// Either end of the range can move on its own, so check it against
+		// the one already stored.
+		var stored models.Menu
+		if err := menuCollection.FindOne(ctx, filter).Decode(&stored); err == nil {
+			if menu.Start_Date == nil {
+				menu.Start_Date = stored.Start_Date
+			}
+			if menu.End_Date == nil {
+				menu.End_Date = stored.End_Date
+			}
+		}
+		if menu.Start_Date != nil && menu.End_Date != nil && !menu.End_Date.After(*menu.Start_Date) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "end_date must be after start_date"})
 		}
 		updateObj = append(updateObj, bson.E{Key: "start_date", Value: menu.Start_Date})
 		updateObj = append(updateObj, bson.E{Key: "end_date", Value: menu.End_Date})
 	}
+	if menu.Dayparts != nil {
+		if err := validate.Var(menu.Dayparts, "dive"); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if msg := checkDayparts(menu.Dayparts); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		updateObj = append(updateObj, bson.E{Key: "dayparts", Value: menu.Dayparts})
+	}
 
 	if menu.Name != "" {
 		updateObj = append(updateObj, bson.E{Key: "name", Value: menu.Name})
@@ -128,3 +167,125 @@ func UpdateMenu(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(result)
 }
+
+// menuActiveAt reports whether the menu is served at the given time: within
+// its date range, when it has one, and in one of its dayparts, when it has
+// any.
+func menuActiveAt(menu models.Menu, at time.Time) bool {
+	switch {
+	case menu.Start_Date != nil && menu.End_Date != nil:
+		if !inTimeSpan(*menu.Start_Date, *menu.End_Date, at) {
+			return false
+		}
+	case menu.Start_Date != nil:
+		if at.Before(*menu.Start_Date) {
+			return false
+		}
+	case menu.End_Date != nil:
+		if !at.Before(*menu.End_Date) {
+			return false
+		}
+	}
+	if len(menu.Dayparts) == 0 {
+		return true
+	}
+	for _, daypart := range menu.Dayparts {
+		if inDaypart(daypart, at) {
+			return true
+		}
+	}
+	return false
+}
+
+// A daypart that starts and ends at the same time could mean no time or the
+// whole day, so it is refused. Leave out dayparts to serve a menu all day.
+func checkDayparts(dayparts []models.Daypart) string {
+	for _, daypart := range dayparts {
+		if daypart.Start == daypart.End {
+			return "daypart " + daypart.Name + " must end at a different time than it starts"
+		}
+	}
+	return ""
+}
+
+var weekdays = [...]string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+func inDaypart(daypart models.Daypart, at time.Time) bool {
+	start, err := time.Parse("15:04", daypart.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", daypart.End)
+	if err != nil {
+		return false
+	}
+
+	at = at.In(time.Local)
+	minute := at.Hour()*60 + at.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	day := at.Weekday()
+	switch {
+	case from < to:
+		if minute < from || minute >= to {
+			return false
+		}
+	case minute >= from:
+	case minute < to:
+		// Past midnight, so the window started the day before.
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(daypart.Days) == 0 {
+		return true
+	}
+	for _, name := range daypart.Days {
+		if name == weekdays[day] {
+			return true
+		}
+	}
+	return false
+}
+
+// activeMenuIds lists the menus served at the given time.
+func activeMenuIds(ctx context.Context, at time.Time) ([]string, error) {
+	filter := bson.M{"$and": bson.A{
+		bson.M{"$or": bson.A{bson.M{"start_date": nil}, bson.M{"start_date": bson.M{"$lte": at}}}},
+		bson.M{"$or": bson.A{bson.M{"end_date": nil}, bson.M{"end_date": bson.M{"$gt": at}}}},
+	}}
+	result, err := menuCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var menus []models.Menu
+	if err := result.All(ctx, &menus); err != nil {
+		return nil, err
+	}
+
+	menuIds := []string{}
+	for _, menu := range menus {
+		if menuActiveAt(menu, at) {
+			menuIds = append(menuIds, menu.Menu_id)
+		}
+	}
+	return menuIds, nil
+}
+
+// foodOnActiveMenu reports whether the food's menu is served at the given
+// time. Foods without a menu are always served.
+func foodOnActiveMenu(ctx context.Context, food models.Food, at time.Time) (bool, error) {
+	if food.Menu_id == nil {
+		return true, nil
+	}
+	var menu models.Menu
+	err := menuCollection.FindOne(ctx, bson.M{"menu_id": *food.Menu_id}).Decode(&menu)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return menuActiveAt(menu, at), nil
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -16,12 +17,26 @@ import (
 	"golang-restaurant-management/models"
 )
 
-var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
 var orderCollection *mongo.Collection = database.OpenCollection(database.Client, "order")
 
+// Legal moves of the order lifecycle. PAID and CANCELLED are terminal.
+var orderTransitions = map[string][]string{
+	models.OrderPlaced:    {models.OrderInKitchen, models.OrderCancelled},
+	models.OrderInKitchen: {models.OrderReady, models.OrderCancelled},
+	models.OrderReady:     {models.OrderServed, models.OrderInKitchen},
+	models.OrderServed:    {models.OrderPaid, models.OrderInKitchen},
+}
+
+var (
+	errOrderNotFound     = errors.New("order was not found")
+	errIllegalTransition = errors.New("illegal order status transition")
+)
+
 func GetOrders(c *fiber.Ctx) error {
-	result, err := orderCollection.Find(context.TODO(), bson.M{})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	result, err := orderCollection.Find(ctx, bson.M{})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing order items"})
 	}
@@ -34,6 +49,9 @@ func GetOrders(c *fiber.Ctx) error {
 }
 
 func GetOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
 	orderId := c.Params("order_id")
 	var order models.Order
 
@@ -45,6 +63,9 @@ func GetOrder(c *fiber.Ctx) error {
 }
 
 func CreateOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
 	var table models.Table
 	var order models.Order
 
@@ -70,9 +91,15 @@ func CreateOrder(c *fiber.Ctx) error {
 
 	order.ID = primitive.NewObjectID()
 	order.Order_id = order.ID.Hex()
+	placeOrder(&order, currentUserId(c))
+
+	if err := occupyTable(ctx, order.Table_id, order.Order_id, order.Created_at); err != nil {
+		return tableError(c, err)
+	}
 
 	result, insertErr := orderCollection.InsertOne(ctx, order)
 	if insertErr != nil {
+		releaseTable(ctx, order.Order_id, models.TableFree)
 		msg := fmt.Sprintf("order was not created")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": msg})
 	}
@@ -81,6 +108,9 @@ func CreateOrder(c *fiber.Ctx) error {
 }
 
 func UpdateOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
 	var table models.Table
 	var order models.Order
 	var updateObj primitive.D
@@ -98,10 +128,32 @@ func UpdateOrder(c *fiber.Ctx) error {
 		}
 		updateObj = append(updateObj, bson.E{Key: "table_id", Value: order.Table_id})
 	}
+	if order.Server_id != nil {
+		count, err := userCollection.CountDocuments(ctx, bson.M{"user_id": order.Server_id})
+		if err != nil || count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "server was not found"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "server_id", Value: order.Server_id})
+	}
 
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: order.Updated_at})
 
+	// Moving an open order to another table moves the guests with it. The new
+	// table is claimed before the old one is let go.
+	if order.Table_id != nil {
+		var seated models.Table
+		err := tableCollection.FindOne(ctx, bson.M{"current_order_id": orderId}).Decode(&seated)
+		if err == nil && seated.Table_id != *order.Table_id {
+			if err := occupyTable(ctx, order.Table_id, orderId, time.Now()); err != nil {
+				return tableError(c, err)
+			}
+			if err := vacateTable(ctx, bson.M{"table_id": seated.Table_id, "current_order_id": orderId}, models.TableFree); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "table status update failed"})
+			}
+		}
+	}
+
 	upsert := true
 	filter := bson.M{"order_id": orderId}
 	opt := options.UpdateOptions{Upsert: &upsert}
@@ -120,12 +172,148 @@ func UpdateOrder(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(result)
 }
 
-func OrderItemOrderCreator(order models.Order) string {
+func UpdateOrderStatus(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var body struct {
+		Order_status string `json:"order_status" validate:"required,eq=IN_KITCHEN|eq=READY|eq=SERVED|eq=CANCELLED"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	order, err := transitionOrder(ctx, c.Params("order_id"), body.Order_status, currentUserId(c))
+	if err != nil {
+		return orderTransitionError(c, err)
+	}
+
+	if body.Order_status == models.OrderCancelled {
+		if err := cancelOpenOrderItems(ctx, order.Order_id, currentUserId(c)); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "order items could not be cancelled"})
+		}
+		if err := releaseTable(ctx, order.Order_id, models.TableFree); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "table status update failed"})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+func OrderItemOrderCreator(order models.Order, placedBy string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
 	order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.ID = primitive.NewObjectID()
 	order.Order_id = order.ID.Hex()
+	placeOrder(&order, placedBy)
+
+	// The table is claimed first so two orders cannot both be seated at it.
+	if err := occupyTable(ctx, order.Table_id, order.Order_id, order.Created_at); err != nil {
+		return "", err
+	}
+	if _, err := orderCollection.InsertOne(ctx, order); err != nil {
+		releaseTable(ctx, order.Order_id, models.TableFree)
+		return "", err
+	}
+	return order.Order_id, nil
+}
+
+func placeOrder(order *models.Order, placedBy string) {
+	if order.Server_id == nil && placedBy != "" {
+		order.Server_id = &placedBy
+	}
+	status := models.OrderPlaced
+	order.Order_status = &status
+	order.Status_history = []models.OrderStatusChange{{
+		To:         status,
+		Changed_by: placedBy,
+		Changed_at: order.Created_at,
+	}}
+}
+
+func orderStatus(order models.Order) string {
+	// Orders created before the lifecycle existed have no status yet.
+	if order.Order_status == nil {
+		return models.OrderPlaced
+	}
+	return *order.Order_status
+}
+
+func canTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func transitionOrder(ctx context.Context, orderId, to, changedBy string) (models.Order, error) {
+	var order models.Order
+	err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+	if err != nil {
+		return order, errOrderNotFound
+	}
+
+	from := orderStatus(order)
+	if !canTransitionOrder(from, to) {
+		return order, fmt.Errorf("%w: cannot move order from %s to %s", errIllegalTransition, from, to)
+	}
+
+	now := time.Now()
+	change := models.OrderStatusChange{From: from, To: to, Changed_by: changedBy, Changed_at: now}
+
+	// Match on the status we validated against so concurrent moves cannot both win.
+	filter := bson.M{"order_id": orderId, "order_status": order.Order_status}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "order_status", Value: to},
+			{Key: "updated_at", Value: now},
+		}},
+		{Key: "$push", Value: bson.D{{Key: "status_history", Value: change}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err = orderCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return order, fmt.Errorf("%w: order status changed concurrently, retry", errIllegalTransition)
+	}
+	return order, err
+}
+
+// undoOrderTransition puts an order back to the status it had before a move
+// whose follow-up work failed. It does nothing if the order has moved on since.
+func undoOrderTransition(ctx context.Context, orderId, from, to string) error {
+	filter := bson.M{"order_id": orderId, "order_status": to}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "order_status", Value: from},
+			{Key: "updated_at", Value: time.Now()},
+		}},
+		{Key: "$pop", Value: bson.D{{Key: "status_history", Value: 1}}},
+	}
+	_, err := orderCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func orderTransitionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errOrderNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errIllegalTransition):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "order status update failed"})
+	}
+}
 
-	orderCollection.InsertOne(ctx, order)
-	return order.Order_id
+func currentUserId(c *fiber.Ctx) string {
+	uid, _ := c.Locals("uid").(string)
+	return uid
 }
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"golang-restaurant-management/models"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+	allowed := map[[2]string]bool{
+		{models.OrderPlaced, models.OrderInKitchen}:    true,
+		{models.OrderPlaced, models.OrderCancelled}:    true,
+		{models.OrderInKitchen, models.OrderReady}:     true,
+		{models.OrderInKitchen, models.OrderCancelled}: true,
+		{models.OrderReady, models.OrderServed}:        true,
+		{models.OrderReady, models.OrderInKitchen}:     true,
+		{models.OrderServed, models.OrderPaid}:         true,
+		{models.OrderServed, models.OrderInKitchen}:    true,
+	}
+	statuses := []string{
+		models.OrderPlaced,
+		models.OrderInKitchen,
+		models.OrderReady,
+		models.OrderServed,
+		models.OrderPaid,
+		models.OrderCancelled,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := canTransitionOrder(from, to); got != want {
+				t.Errorf("canTransitionOrder(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+	if canTransitionOrder("", models.OrderInKitchen) || canTransitionOrder(models.OrderPlaced, "SHIPPED") {
+		t.Error("unknown statuses must not transition")
+	}
+}
+
+func TestOrderStatus(t *testing.T) {
+	ready := models.OrderReady
+	tests := []struct {
+		name  string
+		order models.Order
+		want  string
+	}{
+		{"stored status", models.Order{Order_status: &ready}, models.OrderReady},
+		{"order from before the lifecycle", models.Order{}, models.OrderPlaced},
+	}
+	for _, tt := range tests {
+		if got := orderStatus(tt.order); got != tt.want {
+			t.Errorf("%s: orderStatus = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	server := "server-1"
+	tests := []struct {
+		name       string
+		order      models.Order
+		placedBy   string
+		wantServer *string
+	}{
+		{"placer serves the order", models.Order{}, "waiter-1", stringPtr("waiter-1")},
+		{"named server is kept", models.Order{Server_id: &server}, "waiter-1", &server},
+		{"no one to serve", models.Order{}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := tt.order
+			order.Created_at = time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+			placeOrder(&order, tt.placedBy)
+
+			if orderStatus(order) != models.OrderPlaced {
+				t.Errorf("status = %s, want %s", orderStatus(order), models.OrderPlaced)
+			}
+			if (order.Server_id == nil) != (tt.wantServer == nil) || (order.Server_id != nil && *order.Server_id != *tt.wantServer) {
+				t.Errorf("Server_id = %v, want %v", order.Server_id, tt.wantServer)
+			}
+			if len(order.Status_history) != 1 {
+				t.Fatalf("status history has %d entries, want 1", len(order.Status_history))
+			}
+			change := order.Status_history[0]
+			if change.From != "" || change.To != models.OrderPlaced || change.Changed_by != tt.placedBy || !change.Changed_at.Equal(order.Created_at) {
+				t.Errorf("status history = %+v", change)
+			}
+		})
+	}
+}
+
+func TestOrderTransitionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"missing order", errOrderNotFound, fiber.StatusNotFound},
+		{"illegal move", fmt.Errorf("%w: cannot move order from PAID to READY", errIllegalTransition), fiber.StatusConflict},
+		{"lost race", fmt.Errorf("%w: order status changed concurrently, retry", errIllegalTransition), fiber.StatusConflict},
+		{"database failure", errors.New("connection reset"), fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error { return orderTransitionError(c, tt.err) })
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
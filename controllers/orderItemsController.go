@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"log"
+	"math"
 	"net/http"
 	"time"
 
@@ -13,11 +14,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrderItemPack struct {
 	Table_id    *string             `json:"table_id"`
+	Order_id    *string             `json:"order_id"`
 	Order_items []models.OrderItem `json:"order_items"`
 }
 
@@ -33,8 +34,7 @@ func GetOrderItems(c *fiber.Ctx) error {
 	}
 	var allOrderItems []bson.M
 	if err = result.All(ctx, &allOrderItems); err != nil {
-		log.Fatal(err)
-		return err
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(allOrderItems)
 }
@@ -53,7 +53,7 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
 
-	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "order_id", Value: id}}}}
+	matchStage := bson.D{{Key: "$match", Value: billedItems(id)}}
 	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{
 		{Key: "from", Value: "food"},
 		{Key: "localField", Value: "food_id"},
@@ -87,17 +87,39 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 		{Key: "preserveNullAndEmptyArrays", Value: true},
 	}}}
 
+	// Items written before quantities were counts have no numeric quantity and
+	// may lack a captured price; bill those as one unit at the food's price.
+	// Voided units are not billed.
+	quantity := bson.D{{Key: "$subtract", Value: bson.A{
+		bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$isNumber", Value: "$quantity"}}, "$quantity", 1,
+		}}},
+		bson.D{{Key: "$ifNull", Value: bson.A{"$voided_quantity", 0}}},
+	}}}
+	unitPrice := bson.D{{Key: "$ifNull", Value: bson.A{"$unit_price", "$food.price"}}}
+	unitAmount := bson.D{{Key: "$ifNull", Value: bson.A{"$unit_price.amount", "$food.price.amount"}}}
+	currency := models.DefaultCurrency()
+
 	projectStage := bson.D{{Key: "$project", Value: bson.D{
 		{Key: "id", Value: 0},
-		{Key: "amount", Value: "$food.price"},
+		{Key: "amount", Value: bson.D{
+			{Key: "amount", Value: bson.D{{Key: "$multiply", Value: bson.A{quantity, unitAmount}}}},
+			{Key: "currency", Value: currency},
+		}},
 		{Key: "total_count", Value: 1},
+		{Key: "order_item_id", Value: "$order_item_id"},
 		{Key: "food_name", Value: "$food.name"},
 		{Key: "food_image", Value: "$food.food_image"},
 		{Key: "table_number", Value: "$table.table_number"},
 		{Key: "table_id", Value: "$table.table_id"},
 		{Key: "order_id", Value: "$order.order_id"},
-		{Key: "price", Value: "$food.price"},
-		{Key: "quantity", Value: 1},
+		{Key: "price", Value: unitPrice},
+		{Key: "quantity", Value: quantity},
+		{Key: "size", Value: "$size"},
+		{Key: "seat", Value: "$seat"},
+		{Key: "modifiers", Value: "$modifiers"},
+		{Key: "notes", Value: "$notes"},
+		{Key: "bundle_choices", Value: "$bundle_choices"},
 	}}}
 
 	groupStage := bson.D{{Key: "$group", Value: bson.D{
@@ -106,14 +128,17 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 			{Key: "table_id", Value: "$table_id"},
 			{Key: "table_number", Value: "$table_number"},
 		}},
-		{Key: "payment_due", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+		{Key: "payment_due", Value: bson.D{{Key: "$sum", Value: "$amount.amount"}}},
 		{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
 		{Key: "order_items", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
 	}}}
 
 	projectStage2 := bson.D{{Key: "$project", Value: bson.D{
 		{Key: "id", Value: 0},
-		{Key: "payment_due", Value: 1},
+		{Key: "payment_due", Value: bson.D{
+			{Key: "amount", Value: "$payment_due"},
+			{Key: "currency", Value: currency},
+		}},
 		{Key: "total_count", Value: 1},
 		{Key: "table_number", Value: "$_id.table_number"},
 		{Key: "order_items", Value: 1},
@@ -139,6 +164,32 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	return OrderItems, err
 }
 
+// Reads a {amount, currency} document out of an aggregation result.
+func moneyFromResult(value interface{}) models.Money {
+	money := models.NewMoney(0)
+	var doc primitive.M
+	switch v := value.(type) {
+	case primitive.M:
+		doc = v
+	case primitive.D:
+		doc = v.Map()
+	default:
+		return money
+	}
+	switch amount := doc["amount"].(type) {
+	case int32:
+		money.Amount = int64(amount)
+	case int64:
+		money.Amount = amount
+	case float64:
+		money.Amount = int64(math.Round(amount))
+	}
+	if currency, ok := doc["currency"].(string); ok && currency != "" {
+		money.Currency = currency
+	}
+	return money
+}
+
 func GetOrderItem(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
@@ -167,26 +218,174 @@ func UpdateOrderItem(c *fiber.Ctx) error {
 	filter := bson.M{"order_item_id": orderItemId}
 	var updateObj primitive.D
 
-	if orderItem.Unit_price != nil {
-		updateObj = append(updateObj, bson.E{Key: "unit_price", Value: *orderItem.Unit_price})
+	// Voids are audited, so a voided item cannot be edited back onto the bill.
+	var current models.OrderItem
+	if err := orderItemCollection.FindOne(ctx, filter).Decode(&current); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "order item was not found"})
+	}
+	if current.Item_status != nil && *current.Item_status == models.ItemVoided {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "order item has been voided"})
+	}
+
+	// Once the order is ready or its bill is being settled, its items are on
+	// the bill and come off only through an approved void or refund.
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": current.Order_id}).Decode(&order); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "order was not found"})
+	}
+	switch orderStatus(order) {
+	case models.OrderReady, models.OrderServed, models.OrderPaid, models.OrderCancelled:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "items on a " + orderStatus(order) + " order cannot be changed, void them instead"})
+	}
+	settling, err := orderSettling(ctx, order.Order_id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while checking the order's invoices"})
+	}
+	if settling {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "items on an order that is split or partly paid cannot be changed, void them instead"})
+	}
+
+	// A bundle is priced and cooked as a whole, so its lines only take a new
+	// seat or note, and the bundle itself can only be cancelled.
+	isBundle := len(current.Bundle_choices) > 0
+	if isBundle || current.Bundle_item_id != nil {
+		if orderItem.Quantity != nil || orderItem.Food_id != nil || orderItem.Size != nil || orderItem.Modifiers != nil {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "bundle items cannot be changed, cancel the bundle and order it again"})
+		}
 	}
 	if orderItem.Quantity != nil {
+		if err := validate.Var(*orderItem.Quantity, "min=1"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "quantity must be at least 1"})
+		}
+		if *orderItem.Quantity <= current.Voided_quantity {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "quantity must be more than the voided quantity"})
+		}
 		updateObj = append(updateObj, bson.E{Key: "quantity", Value: *orderItem.Quantity})
 	}
-	if orderItem.Food_id != nil {
-		updateObj = append(updateObj, bson.E{Key: "food_id", Value: *orderItem.Food_id})
+
+	// Prices are captured from the menu. Taking money off a line is done with
+	// a discount or comp, which leave an audit trail.
+	if orderItem.Unit_price != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unit_price cannot be set, apply a discount or comp instead"})
+	}
+
+	// A different food, size or choice of modifiers is a different price, so
+	// capture it again.
+	if orderItem.Food_id != nil || orderItem.Size != nil || orderItem.Modifiers != nil {
+		stored := current
+		if orderItem.Food_id == nil {
+			orderItem.Food_id = stored.Food_id
+		}
+		if orderItem.Size == nil {
+			orderItem.Size = stored.Size
+		} else if err := validate.Var(*orderItem.Size, "eq=S|eq=M|eq=L"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "size must be one of S, M or L"})
+		}
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food); err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "food was not found"})
+		}
+		if *orderItem.Food_id != *stored.Food_id {
+			if msg := offSaleMessage(food); msg != "" {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": msg})
+			}
+			if active, err := foodOnActiveMenu(ctx, food, time.Now()); err != nil || !active {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": *food.Name + " is not on a menu being served now"})
+			}
+		}
+		price, ok := unitPriceFor(food, orderItem.Size)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "size " + *orderItem.Size + " is not offered for " + *food.Name})
+		}
+		// The modifiers kept from before must still suit the food.
+		if orderItem.Modifiers == nil {
+			orderItem.Modifiers = stored.Modifiers
+		} else if err := validate.Var(orderItem.Modifiers, "dive"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		modifiers, delta, msg := selectModifiers(food, orderItem.Modifiers)
+		if msg != "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		if price = price.Add(delta); price.Amount < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "modifiers take the price of " + *food.Name + " below zero"})
+		}
+		updateObj = append(updateObj,
+			bson.E{Key: "unit_price", Value: price},
+			bson.E{Key: "food_id", Value: *orderItem.Food_id},
+			bson.E{Key: "size", Value: orderItem.Size},
+			bson.E{Key: "modifiers", Value: modifiers},
+		)
+	}
+	if orderItem.Notes != nil {
+		if err := validate.Var(*orderItem.Notes, "max=200"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "notes must be at most 200 characters"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "notes", Value: *orderItem.Notes})
+	}
+	if orderItem.Seat != nil {
+		if err := validate.Var(*orderItem.Seat, "min=1"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "seat must be at least 1"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "seat", Value: *orderItem.Seat})
+	}
+	// The kitchen moves items along through its own endpoints; here an item
+	// can only be taken off the order.
+	if orderItem.Item_status != nil {
+		if *orderItem.Item_status != models.ItemCancelled {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "item_status can only be set to " + models.ItemCancelled + ", the kitchen moves items along"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "item_status", Value: *orderItem.Item_status})
 	}
 
 	orderItem.Updated_at = time.Now()
 	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: orderItem.Updated_at})
 
-	upsert := true
-	opt := options.UpdateOptions{Upsert: &upsert}
+	// Portions the item needs on top of what it had are counted off first,
+	// so a food that has sold out in the meantime is refused.
+	after := current
+	if orderItem.Quantity != nil {
+		after.Quantity = orderItem.Quantity
+	}
+	if orderItem.Food_id != nil {
+		after.Food_id = orderItem.Food_id
+	}
+	if orderItem.Item_status != nil {
+		after.Item_status = orderItem.Item_status
+	}
+	neededPortions, freedPortions := foodCountChanges(itemStockChange{before: &current, after: &after})
+	if status, msg := reserveFoods(ctx, neededPortions); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
 
-	result, err := orderItemCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, &opt)
+	// Only write over the item as it was read, so the stock and portions
+	// worked out from it are the ones that actually change.
+	unchanged := bson.M{"order_item_id": orderItemId, "updated_at": current.Updated_at}
+	result, err := orderItemCollection.UpdateOne(ctx, unchanged, bson.D{{Key: "$set", Value: updateObj}})
 	if err != nil {
+		releaseFoods(ctx, neededPortions)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Order item update failed"})
 	}
+	if result.MatchedCount == 0 {
+		releaseFoods(ctx, neededPortions)
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "order item was changed by someone else, reload it and try again"})
+	}
+	releaseFoods(ctx, freedPortions)
+
+	eventType := "item_updated"
+	if orderItem.Item_status != nil && *orderItem.Item_status == models.ItemCancelled {
+		eventType = "item_cancelled"
+	}
+	publishKitchenEvent(ctx, eventType, []string{orderItemId})
+	if isBundle && eventType == "item_cancelled" {
+		if err := cancelBundleComponents(ctx, orderItemId, currentUserId(c)); err != nil {
+			log.Printf("order items: components of bundle %s were not cancelled: %v", orderItemId, err)
+		}
+	}
+
+	updateItemStock(ctx, currentUserId(c), itemStockChange{before: &current, after: &after})
+
 	return c.JSON(result)
 }
 
@@ -201,30 +400,188 @@ func CreateOrderItem(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	order.Order_Date = time.Now()
-	order.Table_id = orderItemPack.Table_id
-	order_id := OrderItemOrderCreator(order)
+	// Validate every item before an order is opened or moved so a bad line
+	// does not leave an empty order behind.
+	orderedAt := time.Now()
+	unitPrices := make([]models.Money, len(orderItemPack.Order_items))
+	modifiers := make([][]models.OrderItemModifier, len(orderItemPack.Order_items))
+	bundleChoices := make([][]models.BundleChoice, len(orderItemPack.Order_items))
+	for i, orderItem := range orderItemPack.Order_items {
+		if err := validate.StructExcept(orderItem, "Order_id"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food); err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "food " + *orderItem.Food_id + " was not found"})
+		}
+		if msg := offSaleMessage(food); msg != "" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": msg})
+		}
+		if active, err := foodOnActiveMenu(ctx, food, orderedAt); err != nil || !active {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": *food.Name + " is not on a menu being served now"})
+		}
+		price, ok := unitPriceFor(food, orderItem.Size)
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "size " + *orderItem.Size + " is not offered for " + *food.Name})
+		}
+		itemModifiers, delta, msg := selectModifiers(food, orderItem.Modifiers)
+		if msg != "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		choices, choicesDelta, status, msg := selectBundleChoices(ctx, food, orderItem.Bundle_choices)
+		if msg != "" {
+			return c.Status(status).JSON(fiber.Map{"error": msg})
+		}
+		delta = delta.Add(choicesDelta)
+		bundleChoices[i] = choices
+		if unitPrices[i] = price.Add(delta); unitPrices[i].Amount < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "modifiers take the price of " + *food.Name + " below zero"})
+		}
+		modifiers[i] = itemModifiers
+	}
+
+	// Count the portions off before anything is written, and give them back
+	// if the order turns out not to take the items.
+	portions := map[string]int{}
+	for i, orderItem := range orderItemPack.Order_items {
+		portions[*orderItem.Food_id] += *orderItem.Quantity
+		for _, choice := range bundleChoices[i] {
+			portions[choice.Food_id] += *orderItem.Quantity
+		}
+	}
+	if status, msg := reserveFoods(ctx, portions); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var order_id, reopenedFrom string
+	if orderItemPack.Order_id != nil {
+		err := orderCollection.FindOne(ctx, bson.M{"order_id": orderItemPack.Order_id}).Decode(&order)
+		if err != nil {
+			releaseFoods(ctx, portions)
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "order was not found"})
+		}
+		switch orderStatus(order) {
+		case models.OrderPaid, models.OrderCancelled:
+			releaseFoods(ctx, portions)
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "cannot add items to a " + orderStatus(order) + " order"})
+		case models.OrderReady, models.OrderServed:
+			// Split invoices and payments were worked out from the items the
+			// order had, so they would not cover anything added now.
+			settling, err := orderSettling(ctx, order.Order_id)
+			if err != nil || settling {
+				releaseFoods(ctx, portions)
+				return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "cannot add items to an order that is split or partly paid"})
+			}
+			// New items send the order back to the kitchen.
+			if _, err := transitionOrder(ctx, order.Order_id, models.OrderInKitchen, currentUserId(c)); err != nil {
+				releaseFoods(ctx, portions)
+				return orderTransitionError(c, err)
+			}
+			reopenedFrom = orderStatus(order)
+		}
+		order_id = order.Order_id
+	} else {
+		order.Order_Date = time.Now()
+		order.Table_id = orderItemPack.Table_id
+		orderId, err := OrderItemOrderCreator(order, currentUserId(c))
+		if err != nil {
+			releaseFoods(ctx, portions)
+			return tableError(c, err)
+		}
+		order_id = orderId
+	}
 
 	orderItemsToBeInserted := []interface{}{}
+	orderItems := []models.OrderItem{}
+	kitchenItems := []models.OrderItem{}
 
-	for _, orderItem := range orderItemPack.Order_items {
+	for i, orderItem := range orderItemPack.Order_items {
 		orderItem.Order_id = order_id
-		if err := validate.Struct(orderItem); err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-		}
 		orderItem.ID = primitive.NewObjectID()
 		orderItem.Created_at = time.Now()
 		orderItem.Updated_at = time.Now()
 		orderItem.Order_item_id = orderItem.ID.Hex()
-		num := toFixed(*orderItem.Unit_price, 2)
-		orderItem.Unit_price = &num
+		orderItem.Unit_price = &unitPrices[i]
+		orderItem.Modifiers = modifiers[i]
+		status := models.ItemQueued
+		orderItem.Item_status = &status
+		orderItem.Started_at = nil
+		orderItem.Ready_at = nil
+		orderItem.Voided_quantity = 0
+		orderItem.Bundle_item_id = nil
+		orderItem.Bundle_choices = bundleChoices[i]
+
+		if len(orderItem.Bundle_choices) == 0 {
+			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
+			orderItems = append(orderItems, orderItem)
+			kitchenItems = append(kitchenItems, orderItem)
+			continue
+		}
+
+		// A bundle is billed as one line while the kitchen gets an item for
+		// each of its choices.
+		ready := models.ItemReady
+		orderItem.Item_status = &ready
+		components := make([]models.OrderItem, 0, len(orderItem.Bundle_choices))
+		for j := range orderItem.Bundle_choices {
+			component := bundleComponent(orderItem, orderItem.Bundle_choices[j])
+			orderItem.Bundle_choices[j].Order_item_id = component.Order_item_id
+			components = append(components, component)
+		}
 		orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
+		orderItems = append(orderItems, orderItem)
+		for _, component := range components {
+			orderItemsToBeInserted = append(orderItemsToBeInserted, component)
+			orderItems = append(orderItems, component)
+			kitchenItems = append(kitchenItems, component)
+		}
 	}
 
 	insertedOrderItems, err := orderItemCollection.InsertMany(ctx, orderItemsToBeInserted)
 	if err != nil {
-		log.Fatal(err)
+		// Stock is only taken once the items are in, so there is none to put
+		// back. Drop whatever part of the batch was written and leave the
+		// portions and the order as they were.
+		orderItemIds := make([]string, 0, len(orderItems))
+		for _, orderItem := range orderItems {
+			orderItemIds = append(orderItemIds, orderItem.Order_item_id)
+		}
+		orderItemCollection.DeleteMany(ctx, bson.M{"order_item_id": bson.M{"$in": orderItemIds}})
+		releaseFoods(ctx, portions)
+		switch {
+		case orderItemPack.Order_id == nil:
+			orderCollection.DeleteOne(ctx, bson.M{"order_id": order_id})
+			releaseTable(ctx, order_id, models.TableFree)
+		case reopenedFrom != "":
+			undoOrderTransition(ctx, order_id, reopenedFrom, models.OrderInKitchen)
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "order items were not created"})
 	}
 
+	kitchenItemIds := make([]string, 0, len(kitchenItems))
+	for _, orderItem := range kitchenItems {
+		kitchenItemIds = append(kitchenItemIds, orderItem.Order_item_id)
+	}
+	publishKitchenEvent(ctx, "items_created", kitchenItemIds)
+	queueKitchenTickets(ctx, order_id, kitchenItems)
+
+	stockChanges := make([]itemStockChange, 0, len(orderItems))
+	for i := range orderItems {
+		stockChanges = append(stockChanges, itemStockChange{after: &orderItems[i]})
+	}
+	updateItemStock(ctx, currentUserId(c), stockChanges...)
+
 	return c.JSON(insertedOrderItems)
 }
+
+// orderSettling reports whether the order's bill has been split or has taken
+// a payment, after which its items are fixed.
+func orderSettling(ctx context.Context, orderId string) (bool, error) {
+	count, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": orderId, "$or": bson.A{
+		bson.M{"order_item_ids": bson.M{"$ne": nil}},
+		bson.M{"split_of": bson.M{"$ne": nil}},
+		bson.M{"payments.0": bson.M{"$exists": true}},
+	}})
+	return count > 0, err
+}
@@ -0,0 +1,483 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"golang-restaurant-management/models"
+	"golang-restaurant-management/payments"
+)
+
+type SplitRequest struct {
+	Order_id   *string    `json:"order_id" validate:"required"`
+	Split_type *string    `json:"split_type" validate:"required,eq=EVEN|eq=ITEMS|eq=SEATS"`
+	Parts      *int       `json:"parts" validate:"omitempty,min=2,max=50"`
+	Groups     [][]string `json:"groups"`
+}
+
+type PaymentRequest struct {
+	Payment_method *string       `json:"payment_method" validate:"required,eq=CARD|eq=CASH"`
+	Amount         *models.Money `json:"amount"`
+	Tip            *models.Money `json:"tip"`
+	Card_token     *string       `json:"card_token"`
+}
+
+// SplitInvoice replaces the order's unpaid invoices with one invoice per
+// guest: an even share of the total, a group of order items, or the items on
+// each seat. Items without a seat are billed together on their own invoice.
+func SplitInvoice(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request SplitRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": *request.Order_id}).Decode(&order); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "order was not found"})
+	}
+	if orderStatus(order) != models.OrderServed {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "only served orders can be split, order is " + orderStatus(order)})
+	}
+
+	existing, err := orderInvoices(ctx, order.Order_id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing invoices"})
+	}
+	for _, invoice := range existing {
+		if len(invoice.Payments) > 0 || len(invoice.Discounts) > 0 {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "invoice " + invoice.Invoice_id + " already has payments or discounts"})
+		}
+	}
+
+	var orderItems []models.OrderItem
+	result, err := orderItemCollection.Find(ctx, billedItems(order.Order_id))
+	if err == nil {
+		err = result.All(ctx, &orderItems)
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing order items"})
+	}
+
+	// The party size decides the service charge, so every guest's invoice
+	// carries it.
+	serviceCharge, err := serviceChargeFor(ctx, order)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "unable to look up service charges"})
+	}
+
+	now := time.Now()
+	closed, err := businessDayClosed(ctx, now)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while checking the business day"})
+	}
+	if closed {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "business day " + businessDate(now) + " is closed"})
+	}
+	var invoices []models.Invoice
+	newInvoice := func() models.Invoice {
+		status := models.PaymentPending
+		invoice := models.Invoice{
+			ID:               primitive.NewObjectID(),
+			Order_id:         order.Order_id,
+			Payment_status:   &status,
+			Payment_due_date: now.AddDate(0, 0, 1),
+			Service_charge:   serviceCharge,
+			Created_at:       now,
+			Updated_at:       now,
+		}
+		invoice.Invoice_id = invoice.ID.Hex()
+		return invoice
+	}
+
+	switch *request.Split_type {
+	case models.SplitEven:
+		if request.Parts == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "parts is required for an even split"})
+		}
+		for part := 1; part <= *request.Parts; part++ {
+			invoice := newInvoice()
+			splitPart, splitOf := part, *request.Parts
+			invoice.Split_part = &splitPart
+			invoice.Split_of = &splitOf
+			invoices = append(invoices, invoice)
+		}
+
+	case models.SplitItems:
+		if msg := checkItemGroups(request.Groups, orderItems); msg != "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		for _, group := range request.Groups {
+			invoice := newInvoice()
+			invoice.Order_item_ids = group
+			invoices = append(invoices, invoice)
+		}
+
+	case models.SplitSeats:
+		for _, group := range seatGroups(orderItems) {
+			invoice := newInvoice()
+			invoice.Order_item_ids = group
+			invoices = append(invoices, invoice)
+		}
+		if len(invoices) < 2 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "the order's items are all on one seat"})
+		}
+	}
+
+	if len(existing) > 0 {
+		_, err := invoiceCollection.DeleteMany(ctx, bson.M{"order_id": order.Order_id, "payments.0": bson.M{"$exists": false}})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "existing invoices could not be replaced"})
+		}
+	}
+
+	documents := make([]interface{}, len(invoices))
+	for i, invoice := range invoices {
+		documents[i] = invoice
+	}
+	if _, err := invoiceCollection.InsertMany(ctx, documents); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "invoices were not created"})
+	}
+
+	summary := make([]fiber.Map, 0, len(invoices))
+	for _, invoice := range invoices {
+		bill, err := invoiceBill(ctx, invoice)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "unable to price the invoices"})
+		}
+		summary = append(summary, fiber.Map{
+			"invoice_id":     invoice.Invoice_id,
+			"order_item_ids": invoice.Order_item_ids,
+			"split_part":     invoice.Split_part,
+			"split_of":       invoice.Split_of,
+			"grand_total":    bill.Grand_total,
+		})
+	}
+	return c.JSON(summary)
+}
+
+func RecordPayment(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request PaymentRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	invoice, payment, status, msg := recordPayment(ctx, c.Params("invoice_id"), request, currentUserId(c))
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if err := settleOrder(ctx, invoice.Order_id, currentUserId(c)); err != nil {
+		return orderTransitionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"invoice_id":     invoice.Invoice_id,
+		"payment_status": invoice.Payment_status,
+		"payment":        payment,
+	})
+}
+
+// recordPayment applies a tender to the invoice's outstanding balance. A nil
+// amount pays the whole balance; a tip is taken on top of it and credited to
+// the order's server. Card tenders are charged through the payment provider
+// before anything is written. The write only succeeds if no other payment was
+// recorded in the meantime, so two tills cannot both take the balance.
+func recordPayment(ctx context.Context, invoiceId string, request PaymentRequest, receivedBy string) (models.Invoice, models.Payment, int, string) {
+	var invoice models.Invoice
+	var payment models.Payment
+	if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+		return invoice, payment, http.StatusNotFound, "invoice was not found"
+	}
+	if invoice.Payment_status != nil && *invoice.Payment_status == models.PaymentPaid {
+		return invoice, payment, http.StatusConflict, "invoice is already paid"
+	}
+
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order); err != nil {
+		return invoice, payment, http.StatusNotFound, "order was not found"
+	}
+	if status := orderStatus(order); status != models.OrderServed && status != models.OrderPaid {
+		return invoice, payment, http.StatusConflict, "cannot take payment for a " + status + " order"
+	}
+
+	bill, err := invoiceBill(ctx, invoice)
+	if err != nil {
+		return invoice, payment, http.StatusInternalServerError, "unable to price the invoice"
+	}
+	balance := bill.Grand_total.Sub(amountPaid(invoice))
+
+	method := *request.Payment_method
+	tendered, tip := request.Amount, request.Tip
+	if tip != nil {
+		switch {
+		case tip.Currency != balance.Currency:
+			return invoice, payment, http.StatusBadRequest, "tip must be in " + balance.Currency
+		case tip.Amount < 0:
+			return invoice, payment, http.StatusBadRequest, "tip cannot be negative"
+		case balance.Amount <= 0 && tip.Amount > 0:
+			return invoice, payment, http.StatusConflict, "nothing is owed on this invoice to tip against"
+		}
+	}
+
+	recorded := invoice.Payments
+	if balance.Amount > 0 {
+		if tendered == nil {
+			tendered = &balance
+		}
+		switch {
+		case tendered.Currency != balance.Currency:
+			return invoice, payment, http.StatusBadRequest, "amount must be in " + balance.Currency
+		case tendered.Amount <= 0:
+			return invoice, payment, http.StatusBadRequest, "amount must be positive"
+		case tendered.Amount > balance.Amount && method != models.TenderCash:
+			return invoice, payment, http.StatusBadRequest, fmt.Sprintf("amount is more than the %s balance", balance)
+		case method == models.TenderCard && (request.Card_token == nil || *request.Card_token == ""):
+			return invoice, payment, http.StatusBadRequest, "card_token is required for card payments"
+		}
+
+		payment = models.Payment{
+			Payment_id:     primitive.NewObjectID().Hex(),
+			Payment_method: method,
+			Amount:         *tendered,
+			Tendered:       *tendered,
+			Change:         models.Money{Currency: balance.Currency},
+			Tip:            models.Money{Currency: balance.Currency},
+			Server_id:      orderServer(order),
+			Received_by:    receivedBy,
+			Received_at:    time.Now(),
+		}
+		if tendered.Amount > balance.Amount {
+			payment.Amount = balance
+		}
+		if tip != nil {
+			payment.Tip = *tip
+		}
+		if method == models.TenderCash {
+			// A cash tip is kept out of the notes handed over, so it is not
+			// given back as change.
+			payment.Change = tendered.Sub(payment.Amount).Sub(payment.Tip)
+			if payment.Change.Amount < 0 {
+				return invoice, payment, http.StatusBadRequest, fmt.Sprintf("%s tendered does not cover the payment and its tip", tendered)
+			}
+		} else {
+			payment.Tendered = payment.Tendered.Add(payment.Tip)
+		}
+
+		if method == models.TenderCard {
+			status, msg := chargeCard(ctx, invoice.Invoice_id, &payment, *request.Card_token)
+			if msg != "" {
+				return invoice, payment, status, msg
+			}
+		}
+		recorded = append(recorded, payment)
+	}
+
+	status := models.PaymentPartiallyPaid
+	if payment.Amount.Amount >= balance.Amount {
+		status = models.PaymentPaid
+	}
+
+	updateObj := bson.D{
+		{Key: "payments", Value: recorded},
+		{Key: "payment_status", Value: status},
+		{Key: "updated_at", Value: time.Now()},
+	}
+	if invoice.Payment_method == nil || *invoice.Payment_method == "" {
+		updateObj = append(updateObj, bson.E{Key: "payment_method", Value: method})
+	}
+
+	filter := bson.M{
+		"invoice_id": invoice.Invoice_id,
+		"payments." + strconv.Itoa(len(invoice.Payments)): bson.M{"$exists": false},
+	}
+	result, err := invoiceCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil || result.MatchedCount == 0 {
+		// The card was charged but the payment could not be kept, so the
+		// money goes back to the guest.
+		if payment.Transaction_id != "" {
+			refundCard(ctx, payment)
+		}
+		if err != nil {
+			return invoice, payment, http.StatusInternalServerError, "payment was not recorded"
+		}
+		return invoice, payment, http.StatusConflict, "another payment was recorded for this invoice, check the balance and try again"
+	}
+
+	invoice.Payments = recorded
+	invoice.Payment_status = &status
+	return invoice, payment, 0, ""
+}
+
+// chargeCard authorizes and captures the payment and its tip with the
+// configured provider. A declined or failed charge is recorded on the invoice
+// with the provider's reason.
+func chargeCard(ctx context.Context, invoiceId string, payment *models.Payment, cardToken string) (int, string) {
+	provider, err := payments.Current()
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	payment.Provider = provider.Name()
+	charge := payment.Amount.Add(payment.Tip)
+
+	failure := models.PaymentFailure{
+		Payment_method: payment.Payment_method,
+		Amount:         charge,
+		Provider:       provider.Name(),
+		Attempted_by:   payment.Received_by,
+		Attempted_at:   time.Now(),
+	}
+	failed := func(result payments.Result, err error) (int, string) {
+		failure.Transaction_id = result.Transaction_id
+		failure.Failure_reason = result.Failure_reason
+		status := http.StatusPaymentRequired
+		if err != nil {
+			failure.Failure_reason = err.Error()
+			status = http.StatusBadGateway
+		}
+		pushInvoiceEntry(ctx, invoiceId, "failed_payments", failure)
+		return status, "card payment failed: " + failure.Failure_reason
+	}
+
+	authorization, err := provider.Authorize(ctx, payments.AuthorizeRequest{
+		Reference:  invoiceId,
+		Amount:     charge,
+		Card_token: cardToken,
+	})
+	if err != nil || !authorization.Approved {
+		return failed(authorization, err)
+	}
+
+	capture, err := provider.Capture(ctx, authorization.Transaction_id, charge)
+	if err != nil || !capture.Approved {
+		provider.Void(ctx, authorization.Transaction_id)
+		capture.Transaction_id = authorization.Transaction_id
+		return failed(capture, err)
+	}
+
+	payment.Transaction_id = authorization.Transaction_id
+	return 0, ""
+}
+
+func refundCard(ctx context.Context, payment models.Payment) {
+	provider, err := payments.Current()
+	if err != nil || provider.Name() != payment.Provider {
+		return
+	}
+	provider.Refund(ctx, payment.Transaction_id, payment.Amount.Add(payment.Tip))
+}
+
+// settleOrder marks the order paid and frees its table once every invoice
+// for it has been paid.
+func settleOrder(ctx context.Context, orderId, changedBy string) error {
+	open, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": orderId, "payment_status": bson.M{"$ne": models.PaymentPaid}})
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+		return errOrderNotFound
+	}
+	if orderStatus(order) != models.OrderServed {
+		return nil
+	}
+
+	if _, err := transitionOrder(ctx, orderId, models.OrderPaid, changedBy); err != nil {
+		return err
+	}
+	return releaseTable(ctx, orderId, models.TableCleaning)
+}
+
+// The server is whoever owns the order; orders from before servers were
+// recorded fall back to whoever placed them.
+func orderServer(order models.Order) string {
+	if order.Server_id != nil {
+		return *order.Server_id
+	}
+	if len(order.Status_history) > 0 {
+		return order.Status_history[0].Changed_by
+	}
+	return ""
+}
+
+func orderInvoices(ctx context.Context, orderId string) ([]models.Invoice, error) {
+	result, err := invoiceCollection.Find(ctx, bson.M{"order_id": orderId})
+	if err != nil {
+		return nil, err
+	}
+	var invoices []models.Invoice
+	err = result.All(ctx, &invoices)
+	return invoices, err
+}
+
+// Every item on the order has to end up on exactly one invoice.
+func checkItemGroups(groups [][]string, orderItems []models.OrderItem) string {
+	if len(groups) < 2 {
+		return "at least two groups of order items are required"
+	}
+
+	unbilled := make(map[string]bool, len(orderItems))
+	for _, orderItem := range orderItems {
+		unbilled[orderItem.Order_item_id] = true
+	}
+	for _, group := range groups {
+		if len(group) == 0 {
+			return "groups cannot be empty"
+		}
+		for _, id := range group {
+			if !unbilled[id] {
+				return "order item " + id + " is not on the order or is in more than one group"
+			}
+			delete(unbilled, id)
+		}
+	}
+	if len(unbilled) > 0 {
+		return "every order item has to be in a group"
+	}
+	return ""
+}
+
+func seatGroups(orderItems []models.OrderItem) [][]string {
+	bySeat := map[int][]string{}
+	for _, orderItem := range orderItems {
+		seat := 0
+		if orderItem.Seat != nil {
+			seat = *orderItem.Seat
+		}
+		bySeat[seat] = append(bySeat[seat], orderItem.Order_item_id)
+	}
+
+	seats := make([]int, 0, len(bySeat))
+	for seat := range bySeat {
+		seats = append(seats, seat)
+	}
+	sort.Ints(seats)
+
+	groups := make([][]string, 0, len(seats))
+	for _, seat := range seats {
+		groups = append(groups, bySeat[seat])
+	}
+	return groups
+}
@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"golang-restaurant-management/printing"
+	"golang-restaurant-management/receipts"
+)
+
+var printJobCollection *mongo.Collection = database.OpenCollection(database.Client, "printJob")
+
+const (
+	printPollInterval = 2 * time.Second
+	printTimeout      = 15 * time.Second
+	// A claimed job is left alone for this long, so another instance does
+	// not print it twice while it is being sent.
+	printLease       = time.Minute
+	printMaxAttempts = 6
+	printMaxBackoff  = 5 * time.Minute
+	ticketLineWidth  = 42
+)
+
+func GetPrintJobs(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	if stationId := c.Query("station_id"); stationId != "" {
+		filter["station_id"] = stationId
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(200)
+	result, err := printJobCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing print jobs"})
+	}
+
+	jobs := []models.PrintJob{}
+	if err := result.All(ctx, &jobs); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(jobs)
+}
+
+// RetryPrintJob queues a job again straight away: a failed job once its
+// printer is back, or a printed one for a lost ticket.
+func RetryPrintJob(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var job models.PrintJob
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := printJobCollection.FindOneAndUpdate(ctx,
+		bson.M{"print_job_id": c.Params("print_job_id")},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.PrintPending},
+			{Key: "attempts", Value: 0},
+			{Key: "next_attempt_at", Value: now},
+			{Key: "updated_at", Value: now},
+		}}},
+		opts,
+	).Decode(&job)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "print job was not found"})
+	}
+	return c.JSON(job)
+}
+
+// queueKitchenTickets renders a ticket for each station the new items go to
+// and queues them for printing. The items are already on the order, so a
+// ticket that cannot be queued is logged rather than failing the request.
+func queueKitchenTickets(ctx context.Context, orderId string, orderItems []models.OrderItem) {
+	jobs, err := kitchenPrintJobs(ctx, orderId, orderItems)
+	if err != nil {
+		log.Printf("print: tickets for order %s were not queued: %v", orderId, err)
+		return
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	documents := make([]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		documents = append(documents, job)
+	}
+	if _, err := printJobCollection.InsertMany(ctx, documents); err != nil {
+		log.Printf("print: tickets for order %s were not queued: %v", orderId, err)
+	}
+}
+
+func kitchenPrintJobs(ctx context.Context, orderId string, orderItems []models.OrderItem) ([]models.PrintJob, error) {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+		return nil, err
+	}
+	stations, defaultStation, err := ticketStations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	foodIds := []string{}
+	for _, orderItem := range orderItems {
+		foodIds = append(foodIds, *orderItem.Food_id)
+	}
+	result, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var foods []models.Food
+	if err := result.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+	foodsById := map[string]models.Food{}
+	for _, food := range foods {
+		foodsById[food.Food_id] = food
+	}
+
+	now := time.Now()
+	ticket := receipts.Ticket{
+		Order_id:   orderId,
+		Printed_at: now,
+		Server:     orderServerName(ctx, order),
+	}
+	if order.Table_id != nil {
+		var table models.Table
+		err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table)
+		if err == nil && table.Table_number != nil {
+			ticket.Table_number = fmt.Sprint(*table.Table_number)
+		}
+	}
+
+	// Items keep the order they were entered in on each station's ticket.
+	var stationOrder []string
+	itemsByStation := map[string][]models.OrderItem{}
+	for _, orderItem := range orderItems {
+		stationId := defaultStation
+		if food, ok := foodsById[*orderItem.Food_id]; ok && food.Station_id != nil {
+			if _, ok := stations[*food.Station_id]; ok {
+				stationId = *food.Station_id
+			}
+		}
+		if stationId == "" {
+			log.Printf("print: order item %s has no station and there is no default station", orderItem.Order_item_id)
+			continue
+		}
+		if _, ok := itemsByStation[stationId]; !ok {
+			stationOrder = append(stationOrder, stationId)
+		}
+		itemsByStation[stationId] = append(itemsByStation[stationId], orderItem)
+	}
+
+	jobs := []models.PrintJob{}
+	for _, stationId := range stationOrder {
+		stationTicket := ticket
+		stationTicket.Station = *stations[stationId].Name
+		orderItemIds := []string{}
+		for _, orderItem := range itemsByStation[stationId] {
+			item := receipts.TicketItem{Quantity: *orderItem.Quantity}
+			if food, ok := foodsById[*orderItem.Food_id]; ok && food.Name != nil {
+				item.Name = *food.Name
+			}
+			if orderItem.Size != nil {
+				item.Size = *orderItem.Size
+			}
+			if orderItem.Seat != nil {
+				item.Seat = *orderItem.Seat
+			}
+			for _, modifier := range orderItem.Modifiers {
+				item.Modifiers = append(item.Modifiers, modifier.Name)
+			}
+			if orderItem.Notes != nil {
+				item.Notes = *orderItem.Notes
+			}
+			stationTicket.Items = append(stationTicket.Items, item)
+			orderItemIds = append(orderItemIds, orderItem.Order_item_id)
+		}
+
+		job := models.PrintJob{
+			ID:              primitive.NewObjectID(),
+			Station_id:      stationId,
+			Order_id:        orderId,
+			Order_item_ids:  orderItemIds,
+			Data:            receipts.ESCPOS(receipts.TicketLayout(stationTicket, ticketLineWidth), ticketLineWidth),
+			Status:          models.PrintPending,
+			Next_attempt_at: now,
+			Created_at:      now,
+			Updated_at:      now,
+		}
+		job.Print_job_id = job.ID.Hex()
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// ticketStations returns the stations by id along with the default one, which
+// takes foods that name no station or one that no longer exists.
+func ticketStations(ctx context.Context) (map[string]models.Station, string, error) {
+	result, err := stationCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, "", err
+	}
+	var stations []models.Station
+	if err := result.All(ctx, &stations); err != nil {
+		return nil, "", err
+	}
+
+	byId := map[string]models.Station{}
+	defaultStation := ""
+	for _, station := range stations {
+		byId[station.Station_id] = station
+		if station.Default != nil && *station.Default {
+			defaultStation = station.Station_id
+		}
+	}
+	return byId, defaultStation, nil
+}
+
+func orderServerName(ctx context.Context, order models.Order) string {
+	if order.Server_id == nil {
+		return ""
+	}
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": order.Server_id}).Decode(&user); err != nil || user.First_name == nil {
+		return ""
+	}
+	return *user.First_name
+}
+
+// StartPrintQueue sends queued tickets to their station printers in the
+// background. A job that fails is retried with a growing delay and marked
+// failed after printMaxAttempts, which tells the kitchen screens.
+func StartPrintQueue(printer printing.Printer) {
+	go func() {
+		ticker := time.NewTicker(printPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for sendNextPrintJob(printer) {
+			}
+		}
+	}()
+}
+
+// sendNextPrintJob claims the oldest job that is due and tries to print it.
+// It reports whether there was a job, so the queue can be drained in a loop.
+func sendNextPrintJob(printer printing.Printer) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), printLease)
+	defer cancel()
+
+	now := time.Now()
+	var job models.PrintJob
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+	err := printJobCollection.FindOneAndUpdate(ctx,
+		bson.M{"status": models.PrintPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: "next_attempt_at", Value: now.Add(printLease)}}},
+			{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		},
+		opts,
+	).Decode(&job)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("print: claiming a job failed: %v", err)
+		}
+		return false
+	}
+
+	printErr := printJob(ctx, printer, job)
+	now = time.Now()
+	updateObj := bson.D{{Key: "updated_at", Value: now}}
+	switch {
+	case printErr == nil:
+		updateObj = append(updateObj,
+			bson.E{Key: "status", Value: models.PrintPrinted},
+			bson.E{Key: "printed_at", Value: now},
+			bson.E{Key: "last_error", Value: ""},
+		)
+	case job.Attempts >= printMaxAttempts:
+		updateObj = append(updateObj,
+			bson.E{Key: "status", Value: models.PrintFailed},
+			bson.E{Key: "last_error", Value: printErr.Error()},
+		)
+	default:
+		updateObj = append(updateObj,
+			bson.E{Key: "next_attempt_at", Value: now.Add(printBackoff(job.Attempts))},
+			bson.E{Key: "last_error", Value: printErr.Error()},
+		)
+	}
+
+	_, err = printJobCollection.UpdateOne(ctx, bson.M{"print_job_id": job.Print_job_id}, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil {
+		log.Printf("print: job %s was not updated: %v", job.Print_job_id, err)
+	}
+	if printErr != nil && job.Attempts >= printMaxAttempts {
+		log.Printf("print: job %s failed: %v", job.Print_job_id, printErr)
+		publishKitchenEvent(ctx, "print_failed", job.Order_item_ids)
+	}
+	return true
+}
+
+func printJob(ctx context.Context, printer printing.Printer, job models.PrintJob) error {
+	var station models.Station
+	if err := stationCollection.FindOne(ctx, bson.M{"station_id": job.Station_id}).Decode(&station); err != nil {
+		return fmt.Errorf("station %s was not found", job.Station_id)
+	}
+	if station.Printer_address == nil || *station.Printer_address == "" {
+		return fmt.Errorf("station %s has no printer", *station.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, printTimeout)
+	defer cancel()
+	return printer.Print(ctx, *station.Printer_address, job.Data)
+}
+
+// Waits 2s, 4s, 8s... between attempts, up to printMaxBackoff.
+func printBackoff(attempts int) time.Duration {
+	backoff := time.Second << uint(attempts)
+	if backoff <= 0 || backoff > printMaxBackoff {
+		return printMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,359 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var promotionCollection *mongo.Collection = database.OpenCollection(database.Client, "promotion")
+
+func GetPromotions(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	result, err := promotionCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing promotions"})
+	}
+
+	allPromotions := []bson.M{}
+	if err := result.All(ctx, &allPromotions); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(allPromotions)
+}
+
+func GetPromotion(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var promotion models.Promotion
+	err := promotionCollection.FindOne(ctx, bson.M{"promotion_id": c.Params("promotion_id")}).Decode(&promotion)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "promotion was not found"})
+	}
+	return c.JSON(promotion)
+}
+
+func CreatePromotion(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var promotion models.Promotion
+	if err := c.BodyParser(&promotion); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(promotion); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if msg := checkDiscountShape(*promotion.Discount_type, promotion.Percent_bps, promotion.Amount, *promotion.Scope, promotion.Food_ids, promotion.Categories); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if promotion.Coupon_code != nil {
+		code := strings.ToUpper(*promotion.Coupon_code)
+		promotion.Coupon_code = &code
+		count, err := promotionCollection.CountDocuments(ctx, bson.M{"coupon_code": code})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while checking the coupon code"})
+		}
+		if count > 0 {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "coupon code already exists"})
+		}
+	}
+
+	if promotion.Active == nil {
+		active := true
+		promotion.Active = &active
+	}
+
+	now := time.Now()
+	promotion.ID = primitive.NewObjectID()
+	promotion.Promotion_id = promotion.ID.Hex()
+	promotion.Times_used = 0
+	promotion.Created_at = now
+	promotion.Updated_at = now
+
+	if _, err := promotionCollection.InsertOne(ctx, promotion); err != nil {
+		// The unique index catches a code taken since the check above.
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "coupon code already exists"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "promotion was not created"})
+	}
+	return c.JSON(promotion)
+}
+
+// Only the availability of a promotion can change; its terms are copied onto
+// every invoice it was applied to, so new terms need a new promotion.
+func UpdatePromotion(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var promotion models.Promotion
+	if err := c.BodyParser(&promotion); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var updateObj primitive.D
+	if promotion.Name != nil {
+		updateObj = append(updateObj, bson.E{Key: "name", Value: promotion.Name})
+	}
+	if promotion.Active != nil {
+		updateObj = append(updateObj, bson.E{Key: "active", Value: promotion.Active})
+	}
+	if promotion.Starts_at != nil {
+		updateObj = append(updateObj, bson.E{Key: "starts_at", Value: promotion.Starts_at})
+	}
+	if promotion.Expires_at != nil {
+		updateObj = append(updateObj, bson.E{Key: "expires_at", Value: promotion.Expires_at})
+	}
+	if promotion.Usage_limit != nil {
+		if err := validate.Var(*promotion.Usage_limit, "min=1"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "usage_limit must be at least 1"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "usage_limit", Value: promotion.Usage_limit})
+	}
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: time.Now()})
+
+	result, err := promotionCollection.UpdateOne(ctx, bson.M{"promotion_id": c.Params("promotion_id")}, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "promotion update failed"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "promotion was not found"})
+	}
+	return c.JSON(result)
+}
+
+func ApplyInvoiceDiscount(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var body struct {
+		Coupon_code  *string `json:"coupon_code"`
+		Promotion_id *string `json:"promotion_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filter := bson.M{}
+	switch {
+	case body.Coupon_code != nil:
+		filter["coupon_code"] = strings.ToUpper(*body.Coupon_code)
+	case body.Promotion_id != nil:
+		// Coupon promotions have to be redeemed with their code.
+		filter["promotion_id"] = *body.Promotion_id
+		filter["coupon_code"] = nil
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "coupon_code or promotion_id is required"})
+	}
+
+	invoice, status, msg := discountableInvoice(ctx, c.Params("invoice_id"))
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var promotion models.Promotion
+	if err := promotionCollection.FindOne(ctx, filter).Decode(&promotion); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "promotion was not found"})
+	}
+
+	now := time.Now()
+	switch {
+	case promotion.Active != nil && !*promotion.Active:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "promotion is not active"})
+	case promotion.Starts_at != nil && now.Before(*promotion.Starts_at):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "promotion has not started yet"})
+	case promotion.Expires_at != nil && !now.Before(*promotion.Expires_at):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "promotion has expired"})
+	}
+	for _, applied := range invoice.Discounts {
+		if applied.Promotion_id != nil && *applied.Promotion_id == promotion.Promotion_id {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "promotion is already applied to this invoice"})
+		}
+	}
+
+	// Claim a use before touching the invoice so a limited coupon cannot be
+	// redeemed more often than allowed by concurrent requests.
+	claim := bson.M{"promotion_id": promotion.Promotion_id}
+	if promotion.Usage_limit != nil {
+		claim["times_used"] = bson.M{"$lt": *promotion.Usage_limit}
+	}
+	result, err := promotionCollection.UpdateOne(ctx, claim, bson.D{{Key: "$inc", Value: bson.D{{Key: "times_used", Value: 1}}}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "promotion could not be applied"})
+	}
+	if result.ModifiedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "promotion usage limit reached"})
+	}
+
+	promotionId := promotion.Promotion_id
+	discount := models.InvoiceDiscount{
+		Discount_id:   primitive.NewObjectID().Hex(),
+		Promotion_id:  &promotionId,
+		Coupon_code:   promotion.Coupon_code,
+		Name:          *promotion.Name,
+		Discount_type: *promotion.Discount_type,
+		Percent_bps:   promotion.Percent_bps,
+		Amount:        promotion.Amount,
+		Scope:         *promotion.Scope,
+		Food_ids:      promotion.Food_ids,
+		Categories:    promotion.Categories,
+		Applied_by:    currentUserId(c),
+		Applied_at:    now,
+	}
+
+	if err := pushInvoiceEntry(ctx, invoice.Invoice_id, "discounts", discount); err != nil {
+		promotionCollection.UpdateOne(ctx, bson.M{"promotion_id": promotionId}, bson.D{{Key: "$inc", Value: bson.D{{Key: "times_used", Value: -1}}}})
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "promotion could not be applied"})
+	}
+	return c.JSON(discount)
+}
+
+// CompInvoice records a manual discount. The route only admits managers, and
+// the manager making the call is recorded as the approver.
+func CompInvoice(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var body struct {
+		Name          *string       `json:"name"`
+		Discount_type *string       `json:"discount_type" validate:"required,eq=PERCENTAGE|eq=FIXED"`
+		Percent_bps   *int          `json:"percent_bps" validate:"omitempty,min=1,max=10000"`
+		Amount        *models.Money `json:"amount"`
+		Scope         *string       `json:"scope" validate:"omitempty,eq=ORDER|eq=ITEM|eq=CATEGORY"`
+		Food_ids      []string      `json:"food_ids"`
+		Categories    []string      `json:"categories"`
+		Reason        *string       `json:"reason" validate:"required,min=3,max=200"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	scope := models.ScopeOrder
+	if body.Scope != nil {
+		scope = *body.Scope
+	}
+	if msg := checkDiscountShape(*body.Discount_type, body.Percent_bps, body.Amount, scope, body.Food_ids, body.Categories); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	invoice, status, msg := discountableInvoice(ctx, c.Params("invoice_id"))
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	name := "Manager comp"
+	if body.Name != nil {
+		name = *body.Name
+	}
+	approver := currentUserId(c)
+	discount := models.InvoiceDiscount{
+		Discount_id:   primitive.NewObjectID().Hex(),
+		Name:          name,
+		Discount_type: *body.Discount_type,
+		Percent_bps:   body.Percent_bps,
+		Amount:        body.Amount,
+		Scope:         scope,
+		Food_ids:      body.Food_ids,
+		Categories:    body.Categories,
+		Reason:        body.Reason,
+		Applied_by:    approver,
+		Approved_by:   &approver,
+		Applied_at:    time.Now(),
+	}
+
+	if err := pushInvoiceEntry(ctx, invoice.Invoice_id, "discounts", discount); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "comp could not be applied"})
+	}
+	return c.JSON(discount)
+}
+
+func RemoveInvoiceDiscount(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	invoice, status, msg := discountableInvoice(ctx, c.Params("invoice_id"))
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	discountId := c.Params("discount_id")
+	var removed *models.InvoiceDiscount
+	for i := range invoice.Discounts {
+		if invoice.Discounts[i].Discount_id == discountId {
+			removed = &invoice.Discounts[i]
+		}
+	}
+	if removed == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "discount was not found on this invoice"})
+	}
+
+	_, err := invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoice.Invoice_id}, bson.D{
+		{Key: "$pull", Value: bson.M{"discounts": bson.M{"discount_id": discountId}}},
+		{Key: "$set", Value: bson.M{"updated_at": time.Now()}},
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "discount could not be removed"})
+	}
+
+	// Give the use back so the guest can redeem the coupon again.
+	if removed.Promotion_id != nil {
+		promotionCollection.UpdateOne(ctx, bson.M{"promotion_id": *removed.Promotion_id}, bson.D{{Key: "$inc", Value: bson.D{{Key: "times_used", Value: -1}}}})
+	}
+	return c.JSON(fiber.Map{"message": "discount removed"})
+}
+
+func discountableInvoice(ctx context.Context, invoiceId string) (models.Invoice, int, string) {
+	var invoice models.Invoice
+	if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+		return invoice, http.StatusNotFound, "invoice was not found"
+	}
+	if len(invoice.Payments) > 0 || (invoice.Payment_status != nil && *invoice.Payment_status == models.PaymentPaid) {
+		return invoice, http.StatusConflict, "discounts cannot change once payments are recorded"
+	}
+	if invoice.Split_of != nil {
+		return invoice, http.StatusConflict, "discounts cannot be applied to an even share, apply them before splitting"
+	}
+	closed, err := businessDayClosed(ctx, invoice.Created_at)
+	if err != nil {
+		return invoice, http.StatusInternalServerError, "error occurred while checking the business day"
+	}
+	if closed {
+		return invoice, http.StatusConflict, "business day " + businessDate(invoice.Created_at) + " is closed"
+	}
+	return invoice, 0, ""
+}
+
+func checkDiscountShape(discountType string, percentBps *int, amount *models.Money, scope string, foodIds, categories []string) string {
+	switch {
+	case discountType == models.DiscountPercentage && percentBps == nil:
+		return "percent_bps is required for percentage discounts"
+	case discountType == models.DiscountFixed && amount == nil:
+		return "amount is required for fixed discounts"
+	case discountType == models.DiscountFixed && amount.Amount <= 0:
+		return "amount must be positive"
+	case discountType == models.DiscountFixed && amount.Currency != models.DefaultCurrency():
+		return "amount must be in " + models.DefaultCurrency()
+	case scope == models.ScopeItem && len(foodIds) == 0:
+		return "food_ids are required for item discounts"
+	case scope == models.ScopeCategory && len(categories) == 0:
+		return "categories are required for category discounts"
+	}
+	return ""
+}
@@ -0,0 +1,556 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var purchaseOrderCollection *mongo.Collection = database.OpenCollection(database.Client, "purchaseOrder")
+
+var openPurchaseStatuses = []string{models.PurchaseDraft, models.PurchaseSent, models.PurchasePartiallyReceived}
+
+type ReceiveRequest struct {
+	Lines []ReceivedLine `json:"lines" validate:"required,min=1,dive"`
+	Note  string         `json:"note" validate:"max=200"`
+}
+
+type ReceivedLine struct {
+	Ingredient_id string  `json:"ingredient_id" validate:"required"`
+	Quantity      float64 `json:"quantity" validate:"gt=0"`
+}
+
+type SuggestedLine struct {
+	Ingredient_id string        `json:"ingredient_id"`
+	Name          string        `json:"name"`
+	Unit          string        `json:"unit"`
+	Stock         float64       `json:"stock"`
+	Reorder_level float64       `json:"reorder_level"`
+	Daily_usage   float64       `json:"daily_usage"`
+	On_order      float64       `json:"on_order"`
+	Quantity      float64       `json:"quantity"`
+	Unit_price    *models.Money `json:"unit_price"`
+	Total         models.Money  `json:"total"`
+}
+
+type SuggestedPurchaseOrder struct {
+	Supplier_id   string          `json:"supplier_id"`
+	Supplier_name string          `json:"supplier_name"`
+	Lines         []SuggestedLine `json:"lines"`
+	Total         models.Money    `json:"total"`
+}
+
+type ReorderSuggestion struct {
+	Cover_days      int                      `json:"cover_days"`
+	Lookback_days   int                      `json:"lookback_days"`
+	Purchase_orders []SuggestedPurchaseOrder `json:"purchase_orders"`
+	Unsourced       []SuggestedLine          `json:"unsourced"`
+}
+
+func GetPurchaseOrders(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	if supplierId := c.Query("supplier_id"); supplierId != "" {
+		filter["supplier_id"] = supplierId
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(200)
+	result, err := purchaseOrderCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing purchase orders"})
+	}
+
+	purchaseOrders := []models.PurchaseOrder{}
+	if err := result.All(ctx, &purchaseOrders); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(purchaseOrders)
+}
+
+func GetPurchaseOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var purchaseOrder models.PurchaseOrder
+	err := purchaseOrderCollection.FindOne(ctx, bson.M{"purchase_order_id": c.Params("purchase_order_id")}).Decode(&purchaseOrder)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "purchase order was not found"})
+	}
+	return c.JSON(purchaseOrder)
+}
+
+// CreatePurchaseOrder raises a draft. Lines without a unit price take the
+// supplier's listed price.
+func CreatePurchaseOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var purchaseOrder models.PurchaseOrder
+	if err := c.BodyParser(&purchaseOrder); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(purchaseOrder); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var supplier models.Supplier
+	if err := supplierCollection.FindOne(ctx, bson.M{"supplier_id": purchaseOrder.Supplier_id}).Decode(&supplier); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "supplier was not found"})
+	}
+	lines, total, msg := pricePurchaseLines(ctx, supplier, purchaseOrder.Lines)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	now := time.Now()
+	purchaseOrder.ID = primitive.NewObjectID()
+	purchaseOrder.Purchase_order_id = purchaseOrder.ID.Hex()
+	purchaseOrder.Status = models.PurchaseDraft
+	purchaseOrder.Lines = lines
+	purchaseOrder.Total = total
+	purchaseOrder.Created_by = currentUserId(c)
+	purchaseOrder.Sent_at = nil
+	purchaseOrder.Received_at = nil
+	purchaseOrder.Created_at = now
+	purchaseOrder.Updated_at = now
+
+	if _, err := purchaseOrderCollection.InsertOne(ctx, purchaseOrder); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "purchase order was not created"})
+	}
+	return c.JSON(purchaseOrder)
+}
+
+// UpdatePurchaseOrder changes a draft's lines or notes. Once sent, the order
+// is what the supplier has and only deliveries change it.
+func UpdatePurchaseOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request struct {
+		Lines []models.PurchaseOrderLine `json:"lines" validate:"omitempty,min=1,dive"`
+		Notes *string                    `json:"notes" validate:"omitempty,max=500"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	purchaseOrderId := c.Params("purchase_order_id")
+	var purchaseOrder models.PurchaseOrder
+	if err := purchaseOrderCollection.FindOne(ctx, bson.M{"purchase_order_id": purchaseOrderId}).Decode(&purchaseOrder); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "purchase order was not found"})
+	}
+	if purchaseOrder.Status != models.PurchaseDraft {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "only draft purchase orders can be changed, this one is " + purchaseOrder.Status})
+	}
+
+	updateObj := bson.D{{Key: "updated_at", Value: time.Now()}}
+	if request.Lines != nil {
+		var supplier models.Supplier
+		if err := supplierCollection.FindOne(ctx, bson.M{"supplier_id": purchaseOrder.Supplier_id}).Decode(&supplier); err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "supplier was not found"})
+		}
+		lines, total, msg := pricePurchaseLines(ctx, supplier, request.Lines)
+		if msg != "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		updateObj = append(updateObj, bson.E{Key: "lines", Value: lines}, bson.E{Key: "total", Value: total})
+	}
+	if request.Notes != nil {
+		updateObj = append(updateObj, bson.E{Key: "notes", Value: *request.Notes})
+	}
+
+	return setPurchaseOrder(ctx, c, bson.M{"purchase_order_id": purchaseOrderId, "status": models.PurchaseDraft}, updateObj)
+}
+
+func SendPurchaseOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"purchase_order_id": c.Params("purchase_order_id"), "status": models.PurchaseDraft}
+	return setPurchaseOrder(ctx, c, filter, bson.D{
+		{Key: "status", Value: models.PurchaseSent},
+		{Key: "sent_at", Value: now},
+		{Key: "updated_at", Value: now},
+	})
+}
+
+// CancelPurchaseOrder calls off an order nothing has been delivered
+// against.
+func CancelPurchaseOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"purchase_order_id": c.Params("purchase_order_id"),
+		"status":            bson.M{"$in": []string{models.PurchaseDraft, models.PurchaseSent}},
+	}
+	return setPurchaseOrder(ctx, c, filter, bson.D{
+		{Key: "status", Value: models.PurchaseCancelled},
+		{Key: "updated_at", Value: time.Now()},
+	})
+}
+
+// ReceivePurchaseOrder books a delivery in: the quantities are added to the
+// ingredients' stock and to what the order has received. The order is
+// RECEIVED once every line has arrived in full.
+func ReceivePurchaseOrder(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request ReceiveRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	purchaseOrderId := c.Params("purchase_order_id")
+	var purchaseOrder models.PurchaseOrder
+	if err := purchaseOrderCollection.FindOne(ctx, bson.M{"purchase_order_id": purchaseOrderId}).Decode(&purchaseOrder); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "purchase order was not found"})
+	}
+	if purchaseOrder.Status != models.PurchaseSent && purchaseOrder.Status != models.PurchasePartiallyReceived {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "only sent purchase orders can be received, this one is " + purchaseOrder.Status})
+	}
+
+	lineIndex := map[string]int{}
+	for i, line := range purchaseOrder.Lines {
+		lineIndex[line.Ingredient_id] = i
+	}
+	for _, received := range request.Lines {
+		i, ok := lineIndex[received.Ingredient_id]
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "ingredient " + received.Ingredient_id + " is not on the purchase order"})
+		}
+		purchaseOrder.Lines[i].Received_quantity += received.Quantity
+	}
+
+	now := time.Now()
+	status := models.PurchaseReceived
+	for _, line := range purchaseOrder.Lines {
+		if line.Received_quantity < line.Quantity {
+			status = models.PurchasePartiallyReceived
+		}
+	}
+	updateObj := bson.D{
+		{Key: "lines", Value: purchaseOrder.Lines},
+		{Key: "status", Value: status},
+		{Key: "updated_at", Value: now},
+	}
+	if status == models.PurchaseReceived {
+		updateObj = append(updateObj, bson.E{Key: "received_at", Value: now})
+	}
+
+	// The order must not have changed since it was read, so two deliveries
+	// booked at once cannot overwrite each other's quantities.
+	result, err := purchaseOrderCollection.UpdateOne(ctx,
+		bson.M{"purchase_order_id": purchaseOrderId, "updated_at": purchaseOrder.Updated_at},
+		bson.D{{Key: "$set", Value: updateObj}},
+	)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "delivery was not recorded"})
+	}
+	if result.ModifiedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "purchase order changed while the delivery was recorded, try again"})
+	}
+
+	for _, received := range request.Lines {
+		movement := models.StockMovement{
+			Reason:            models.StockReceived,
+			Purchase_order_id: purchaseOrderId,
+			Note:              request.Note,
+			Created_by:        currentUserId(c),
+		}
+		if _, err := changeStock(ctx, received.Ingredient_id, received.Quantity, movement); err != nil {
+			log.Printf("inventory: delivery of %s on purchase order %s was not added to stock: %v", received.Ingredient_id, purchaseOrderId, err)
+		}
+	}
+
+	purchaseOrder.Status = status
+	purchaseOrder.Updated_at = now
+	if status == models.PurchaseReceived {
+		purchaseOrder.Received_at = &now
+	}
+	return c.JSON(purchaseOrder)
+}
+
+// SuggestReorders proposes purchase orders to keep stock above each
+// ingredient's reorder level for ?days= (7 by default) plus the supplier's
+// lead time, at the daily usage of the last ?lookback= days (14 by default)
+// of order items. What is already on order counts towards the stock. Each
+// ingredient is bought from the supplier listing it cheapest; ingredients
+// no supplier lists come back as unsourced.
+func SuggestReorders(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	coverDays, err := strconv.Atoi(c.Query("days", "7"))
+	if err != nil || coverDays < 1 || coverDays > 90 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "days must be between 1 and 90"})
+	}
+	lookbackDays, err := strconv.Atoi(c.Query("lookback", "14"))
+	if err != nil || lookbackDays < 1 || lookbackDays > 365 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lookback must be between 1 and 365"})
+	}
+
+	var ingredients []models.Ingredient
+	result, err := ingredientCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err == nil {
+		err = result.All(ctx, &ingredients)
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing ingredients"})
+	}
+	usage, err := ingredientUsage(ctx, time.Now().AddDate(0, 0, -lookbackDays))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while working out usage"})
+	}
+	onOrder, err := ingredientsOnOrder(ctx)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing open purchase orders"})
+	}
+	var suppliers []models.Supplier
+	result, err = supplierCollection.Find(ctx, bson.M{})
+	if err == nil {
+		err = result.All(ctx, &suppliers)
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing suppliers"})
+	}
+
+	suggestion := ReorderSuggestion{
+		Cover_days:      coverDays,
+		Lookback_days:   lookbackDays,
+		Purchase_orders: []SuggestedPurchaseOrder{},
+		Unsourced:       []SuggestedLine{},
+	}
+	bySupplier := map[string]*SuggestedPurchaseOrder{}
+	for _, ingredient := range ingredients {
+		supplier, price := cheapestSupplier(suppliers, ingredient.Ingredient_id)
+		cover := float64(coverDays)
+		if supplier != nil && supplier.Lead_time_days != nil {
+			cover += float64(*supplier.Lead_time_days)
+		}
+
+		line := SuggestedLine{
+			Ingredient_id: ingredient.Ingredient_id,
+			Stock:         ingredient.Stock,
+			Daily_usage:   usage[ingredient.Ingredient_id] / float64(lookbackDays),
+			On_order:      onOrder[ingredient.Ingredient_id],
+			Total:         models.NewMoney(0),
+		}
+		if ingredient.Name != nil {
+			line.Name = *ingredient.Name
+		}
+		if ingredient.Unit != nil {
+			line.Unit = *ingredient.Unit
+		}
+		if ingredient.Reorder_level != nil {
+			line.Reorder_level = *ingredient.Reorder_level
+		}
+
+		needed := line.Reorder_level + line.Daily_usage*cover - line.Stock - line.On_order
+		if needed <= 0 {
+			continue
+		}
+		line.Quantity = math.Ceil(needed*100) / 100
+		if supplier == nil {
+			suggestion.Unsourced = append(suggestion.Unsourced, line)
+			continue
+		}
+		if price.Pack_size != nil {
+			line.Quantity = math.Ceil(needed / *price.Pack_size) * *price.Pack_size
+		}
+		line.Unit_price = price.Unit_price
+		line.Total = lineTotal(*price.Unit_price, line.Quantity)
+
+		order, ok := bySupplier[supplier.Supplier_id]
+		if !ok {
+			order = &SuggestedPurchaseOrder{Supplier_id: supplier.Supplier_id, Total: models.NewMoney(0)}
+			if supplier.Name != nil {
+				order.Supplier_name = *supplier.Name
+			}
+			bySupplier[supplier.Supplier_id] = order
+		}
+		order.Lines = append(order.Lines, line)
+		order.Total = order.Total.Add(line.Total)
+	}
+
+	for _, order := range bySupplier {
+		suggestion.Purchase_orders = append(suggestion.Purchase_orders, *order)
+	}
+	sort.Slice(suggestion.Purchase_orders, func(i, j int) bool {
+		return suggestion.Purchase_orders[i].Supplier_name < suggestion.Purchase_orders[j].Supplier_name
+	})
+	return c.JSON(suggestion)
+}
+
+func setPurchaseOrder(ctx context.Context, c *fiber.Ctx, filter bson.M, updateObj bson.D) error {
+	var updated models.PurchaseOrder
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := purchaseOrderCollection.FindOneAndUpdate(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "purchase order was not found or is past that stage"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "purchase order update failed"})
+	}
+	return c.JSON(updated)
+}
+
+// pricePurchaseLines checks the lines name each stocked ingredient once and
+// prices them, from the supplier's list where no price was given.
+func pricePurchaseLines(ctx context.Context, supplier models.Supplier, lines []models.PurchaseOrderLine) ([]models.PurchaseOrderLine, models.Money, string) {
+	currency := models.DefaultCurrency()
+	total := models.NewMoney(0)
+	prices := map[string]*models.Money{}
+	for _, price := range supplier.Prices {
+		prices[price.Ingredient_id] = price.Unit_price
+	}
+
+	ingredientIds := []string{}
+	seen := map[string]bool{}
+	for i := range lines {
+		line := &lines[i]
+		if seen[line.Ingredient_id] {
+			return nil, total, "ingredient " + line.Ingredient_id + " is on the purchase order twice"
+		}
+		seen[line.Ingredient_id] = true
+		ingredientIds = append(ingredientIds, line.Ingredient_id)
+
+		if line.Unit_price == nil {
+			line.Unit_price = prices[line.Ingredient_id]
+		}
+		if line.Unit_price == nil {
+			return nil, total, "supplier has no price for ingredient " + line.Ingredient_id + ", give a unit_price"
+		}
+		if line.Unit_price.Currency != currency || line.Unit_price.Amount < 0 {
+			return nil, total, "unit prices must be in " + currency + " and cannot be negative"
+		}
+		line.Received_quantity = 0
+		total = total.Add(lineTotal(*line.Unit_price, line.Quantity))
+	}
+
+	count, err := ingredientCollection.CountDocuments(ctx, bson.M{"ingredient_id": bson.M{"$in": ingredientIds}})
+	if err != nil || count != int64(len(ingredientIds)) {
+		return nil, total, "purchase order names an ingredient that was not found"
+	}
+	return lines, total, ""
+}
+
+func lineTotal(unitPrice models.Money, quantity float64) models.Money {
+	return models.Money{Amount: int64(math.Round(float64(unitPrice.Amount) * quantity)), Currency: unitPrice.Currency}
+}
+
+// ingredientUsage totals what the order items since the given time used, by
+// ingredient, through the foods' current recipes.
+func ingredientUsage(ctx context.Context, since time.Time) (map[string]float64, error) {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "created_at", Value: bson.D{{Key: "$gte", Value: since}}},
+		{Key: "item_status", Value: bson.D{{Key: "$ne", Value: models.ItemCancelled}}},
+	}}}
+	lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "food"},
+		{Key: "localField", Value: "food_id"},
+		{Key: "foreignField", Value: "food_id"},
+		{Key: "as", Value: "food"},
+	}}}
+	unwindFoodStage := bson.D{{Key: "$unwind", Value: "$food"}}
+	unwindRecipeStage := bson.D{{Key: "$unwind", Value: "$food.recipe"}}
+	quantity := bson.D{{Key: "$cond", Value: bson.A{
+		bson.D{{Key: "$isNumber", Value: "$quantity"}}, "$quantity", 1,
+	}}}
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: "$food.recipe.ingredient_id"},
+		{Key: "used", Value: bson.D{{Key: "$sum", Value: bson.D{
+			{Key: "$multiply", Value: bson.A{quantity, "$food.recipe.quantity"}},
+		}}}},
+	}}}
+
+	result, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
+		matchStage,
+		lookupFoodStage,
+		unwindFoodStage,
+		unwindRecipeStage,
+		groupStage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Ingredient_id string  `bson:"_id"`
+		Used          float64 `bson:"used"`
+	}
+	if err := result.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	usage := map[string]float64{}
+	for _, row := range rows {
+		usage[row.Ingredient_id] = row.Used
+	}
+	return usage, nil
+}
+
+// ingredientsOnOrder is what open purchase orders, drafts included, have
+// still to deliver, by ingredient.
+func ingredientsOnOrder(ctx context.Context) (map[string]float64, error) {
+	var purchaseOrders []models.PurchaseOrder
+	result, err := purchaseOrderCollection.Find(ctx, bson.M{"status": bson.M{"$in": openPurchaseStatuses}})
+	if err != nil {
+		return nil, err
+	}
+	if err := result.All(ctx, &purchaseOrders); err != nil {
+		return nil, err
+	}
+
+	onOrder := map[string]float64{}
+	for _, purchaseOrder := range purchaseOrders {
+		for _, line := range purchaseOrder.Lines {
+			if outstanding := line.Quantity - line.Received_quantity; outstanding > 0 {
+				onOrder[line.Ingredient_id] += outstanding
+			}
+		}
+	}
+	return onOrder, nil
+}
+
+func cheapestSupplier(suppliers []models.Supplier, ingredientId string) (*models.Supplier, *models.SupplierPrice) {
+	var cheapest *models.Supplier
+	var cheapestPrice *models.SupplierPrice
+	for i := range suppliers {
+		for j := range suppliers[i].Prices {
+			price := &suppliers[i].Prices[j]
+			if price.Ingredient_id != ingredientId || price.Unit_price == nil {
+				continue
+			}
+			if cheapestPrice == nil || price.Unit_price.Amount < cheapestPrice.Unit_price.Amount {
+				cheapest, cheapestPrice = &suppliers[i], price
+			}
+		}
+	}
+	return cheapest, cheapestPrice
+}
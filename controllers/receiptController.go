@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+	"golang-restaurant-management/receipts"
+)
+
+var receiptTemplateCollection *mongo.Collection = database.OpenCollection(database.Client, "receiptTemplate")
+
+// The restaurant has one receipt layout, stored under this id.
+const receiptTemplateId = "default"
+
+func GetReceiptTemplate(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	template, err := receiptTemplate(ctx)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while fetching the receipt template"})
+	}
+	return c.JSON(template)
+}
+
+// UpdateReceiptTemplate replaces the receipt layout. Receipts printed
+// afterwards use it, including reprints of older invoices.
+func UpdateReceiptTemplate(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var template models.ReceiptTemplate
+	if err := c.BodyParser(&template); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(template); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	uid, _ := c.Locals("uid").(string)
+	template.ID = primitive.NilObjectID
+	template.Template_id = receiptTemplateId
+	template.Updated_by = uid
+	template.Updated_at = time.Now()
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "template_id", Value: template.Template_id},
+		{Key: "restaurant_name", Value: template.Restaurant_name},
+		{Key: "header_lines", Value: template.Header_lines},
+		{Key: "footer_lines", Value: template.Footer_lines},
+		{Key: "tax_number", Value: template.Tax_number},
+		{Key: "line_width", Value: template.Line_width},
+		{Key: "show_sizes", Value: template.Show_sizes},
+		{Key: "updated_by", Value: template.Updated_by},
+		{Key: "updated_at", Value: template.Updated_at},
+	}}}
+	opts := options.Update().SetUpsert(true)
+	_, err := receiptTemplateCollection.UpdateOne(ctx, bson.M{"template_id": receiptTemplateId}, update, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "receipt template was not saved"})
+	}
+	return c.JSON(template)
+}
+
+// GetReceipt renders the invoice as a receipt. ?format= is text (the
+// default), pdf, or escpos for sending straight to a thermal printer.
+func GetReceipt(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	format := c.Query("format", receipts.FormatText)
+	switch format {
+	case receipts.FormatText, receipts.FormatPDF, receipts.FormatESCPOS:
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be text, pdf or escpos"})
+	}
+
+	var invoice models.Invoice
+	err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": c.Params("invoice_id")}).Decode(&invoice)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "invoice was not found"})
+	}
+
+	invoiceView, status, msg := invoiceViewFor(ctx, invoice)
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	template, err := receiptTemplate(ctx)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while fetching the receipt template"})
+	}
+
+	body, contentType, err := receipts.Render(format, receiptFor(invoiceView), template)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	if format == receipts.FormatPDF {
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("inline; filename=\"receipt-%s.pdf\"", invoice.Invoice_id))
+	}
+	return c.Send(body)
+}
+
+// receiptTemplate returns the saved layout, or a plain one headed with
+// RESTAURANT_NAME until a manager sets one up.
+func receiptTemplate(ctx context.Context) (models.ReceiptTemplate, error) {
+	var template models.ReceiptTemplate
+	err := receiptTemplateCollection.FindOne(ctx, bson.M{"template_id": receiptTemplateId}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		name := os.Getenv("RESTAURANT_NAME")
+		if name == "" {
+			name = "Restaurant"
+		}
+		return models.ReceiptTemplate{Template_id: receiptTemplateId, Restaurant_name: &name}, nil
+	}
+	return template, err
+}
+
+func receiptFor(invoiceView InvoiceViewFormat) receipts.Receipt {
+	receipt := receipts.Receipt{
+		Invoice_id: invoiceView.Invoice_id,
+		Printed_at: time.Now(),
+		Subtotal:   invoiceView.Subtotal,
+		Total:      invoiceView.Grand_total,
+		Paid:       invoiceView.Amount_paid,
+		Balance:    invoiceView.Balance_due,
+	}
+	if invoiceView.Table_number != nil {
+		receipt.Table_number = fmt.Sprint(invoiceView.Table_number)
+	}
+
+	orderItems, _ := invoiceView.Order_details.(primitive.A)
+	for _, value := range orderItems {
+		item, ok := value.(primitive.M)
+		if !ok {
+			continue
+		}
+		line := receipts.Item{Amount: moneyFromResult(item["amount"])}
+		line.Name, _ = item["food_name"].(string)
+		line.Size, _ = item["size"].(string)
+		switch quantity := item["quantity"].(type) {
+		case int32:
+			line.Quantity = int64(quantity)
+		case int64:
+			line.Quantity = quantity
+		case float64:
+			line.Quantity = int64(quantity)
+		}
+		receipt.Items = append(receipt.Items, line)
+	}
+
+	for _, discount := range invoiceView.Discount_lines {
+		receipt.Discounts = append(receipt.Discounts, receipts.Charge{Label: discount.Name, Amount: discount.Amount})
+	}
+	for _, charge := range invoiceView.Service_charges {
+		receipt.Service_charges = append(receipt.Service_charges, receipts.Charge{Label: charge.Name, Amount: charge.Amount})
+	}
+	for _, tax := range invoiceView.Tax_lines {
+		receipt.Taxes = append(receipt.Taxes, receipts.Tax{Label: tax.Name, Amount: tax.Amount, Inclusive: tax.Inclusive})
+	}
+	for _, payment := range invoiceView.Payments {
+		receipt.Payments = append(receipt.Payments, receipts.Tender{
+			Method: payment.Payment_method,
+			Amount: payment.Amount,
+			Tip:    payment.Tip,
+			Change: payment.Change,
+		})
+	}
+	return receipt
+}
@@ -0,0 +1,415 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
+	"golang-restaurant-management/payments"
+)
+
+var refundCollection *mongo.Collection = database.OpenCollection(database.Client, "refund")
+var voidCollection *mongo.Collection = database.OpenCollection(database.Client, "void")
+
+type RefundRequest struct {
+	Amount     *models.Money `json:"amount"`
+	Items      []RefundItem  `json:"items" validate:"omitempty,dive"`
+	Payment_id *string       `json:"payment_id"`
+	Reason     *string       `json:"reason" validate:"required,min=3,max=200"`
+}
+
+// A zero quantity refunds whatever of the item has not been refunded yet.
+type RefundItem struct {
+	Order_item_id string `json:"order_item_id" validate:"required"`
+	Quantity      int64  `json:"quantity" validate:"min=0"`
+}
+
+type VoidRequest struct {
+	Quantity *int    `json:"quantity" validate:"omitempty,min=1"`
+	Reason   *string `json:"reason" validate:"required,min=3,max=200"`
+}
+
+// RefundInvoice gives back part or all of what was paid on an invoice, either
+// a set amount or the charge for some of its items. The route only admits
+// managers, and the manager making the call is recorded as the approver.
+func RefundInvoice(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request RefundRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if (request.Amount == nil) == (len(request.Items) == 0) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "either amount or items is required"})
+	}
+
+	var invoice models.Invoice
+	if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": c.Params("invoice_id")}).Decode(&invoice); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "invoice was not found"})
+	}
+	if len(invoice.Payments) == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "nothing has been paid on this invoice"})
+	}
+	closed, err := businessDayClosed(ctx, invoice.Created_at)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while checking the business day"})
+	}
+	if closed {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "business day " + businessDate(invoice.Created_at) + " is closed"})
+	}
+
+	previous, err := invoiceRefunds(ctx, invoice.Invoice_id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing refunds"})
+	}
+
+	refund := models.Refund{
+		ID:          primitive.NewObjectID(),
+		Invoice_id:  invoice.Invoice_id,
+		Order_id:    invoice.Order_id,
+		Lines:       []models.RefundLine{},
+		Amount:      models.NewMoney(0),
+		Reason:      *request.Reason,
+		Approved_by: currentUserId(c),
+		Created_at:  time.Now(),
+	}
+	refund.Refund_id = refund.ID.Hex()
+
+	if request.Amount != nil {
+		if request.Amount.Currency != refund.Amount.Currency {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "amount must be in " + refund.Amount.Currency})
+		}
+		if request.Amount.Amount <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "amount must be positive"})
+		}
+		refund.Amount = *request.Amount
+	} else {
+		if invoice.Split_of != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "an even share can only be refunded by amount"})
+		}
+		bill, err := invoiceBill(ctx, invoice)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "unable to price the invoice"})
+		}
+		lines, msg := refundLines(bill, request.Items, previous)
+		if msg != "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		refund.Lines = lines
+		for _, line := range lines {
+			refund.Amount = refund.Amount.Add(line.Amount)
+		}
+	}
+
+	payment, msg := refundablePayment(invoice, previous, request.Payment_id, refund.Amount)
+	if msg != "" {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": msg})
+	}
+	refund.Payment_id = payment.Payment_id
+	refund.Payment_method = payment.Payment_method
+
+	var provider payments.Provider
+	if payment.Transaction_id != "" {
+		provider, err = payments.Current()
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if provider.Name() != payment.Provider {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "payment was taken with " + payment.Provider + ", which is not the configured provider"})
+		}
+	}
+
+	// Count the refund against the payment before any money moves, so two
+	// refunds made at once cannot both give back the same money.
+	if status, msg := reserveRefund(ctx, invoice.Invoice_id, payment, refundedSoFar(payment, previous), refund.Amount); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	// Card money goes back through the provider that took it; cash is handed
+	// back at the till.
+	if provider != nil {
+		result, err := provider.Refund(ctx, payment.Transaction_id, refund.Amount)
+		if err != nil {
+			releaseRefund(ctx, invoice.Invoice_id, payment.Payment_id, refund.Amount)
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": "card refund failed: " + err.Error()})
+		}
+		if !result.Approved {
+			releaseRefund(ctx, invoice.Invoice_id, payment.Payment_id, refund.Amount)
+			return c.Status(http.StatusPaymentRequired).JSON(fiber.Map{"error": "card refund failed: " + result.Failure_reason})
+		}
+		refund.Provider = provider.Name()
+		refund.Transaction_id = payment.Transaction_id
+	}
+
+	if _, err := refundCollection.InsertOne(ctx, refund); err != nil {
+		if provider == nil {
+			releaseRefund(ctx, invoice.Invoice_id, payment.Payment_id, refund.Amount)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "refund could not be recorded"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "refund was issued but could not be recorded"})
+	}
+	return c.JSON(refund)
+}
+
+// VoidOrderItem takes some or all of an item off the bill before anything has
+// been paid on the order. The route only admits managers.
+func VoidOrderItem(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request VoidRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var orderItem models.OrderItem
+	if err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": c.Params("order_item_id")}).Decode(&orderItem); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "order item was not found"})
+	}
+	if orderItem.Item_status != nil && (*orderItem.Item_status == models.ItemCancelled || *orderItem.Item_status == models.ItemVoided) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "order item is already " + *orderItem.Item_status})
+	}
+	// A component is free and cooked as part of its bundle, so only the bundle
+	// itself comes off the bill.
+	if orderItem.Bundle_item_id != nil {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "void the bundle this item belongs to instead"})
+	}
+	isBundle := len(orderItem.Bundle_choices) > 0
+
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderItem.Order_id}).Decode(&order); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "order was not found"})
+	}
+	if status := orderStatus(order); status == models.OrderPaid || status == models.OrderCancelled {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "cannot void items on a " + status + " order"})
+	}
+	paid, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": order.Order_id, "payments.0": bson.M{"$exists": true}})
+	if err != nil || paid > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "payments have been taken on this order, refund the item instead"})
+	}
+
+	remaining := *orderItem.Quantity - orderItem.Voided_quantity
+	quantity := remaining
+	if request.Quantity != nil {
+		quantity = *request.Quantity
+	}
+	if quantity > remaining {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "only " + strconv.Itoa(remaining) + " can be voided"})
+	}
+	if isBundle && quantity != remaining {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "a bundle can only be voided as a whole"})
+	}
+
+	unitPrice := models.NewMoney(0)
+	if orderItem.Unit_price != nil {
+		unitPrice = *orderItem.Unit_price
+	} else {
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food); err == nil && food.Price != nil {
+			unitPrice = *food.Price
+		}
+	}
+
+	// Only count the void if nobody voided the same item in the meantime.
+	filter := bson.M{"order_item_id": orderItem.Order_item_id, "voided_quantity": orderItem.Voided_quantity}
+	if orderItem.Voided_quantity == 0 {
+		filter["voided_quantity"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	updateObj := bson.D{
+		{Key: "voided_quantity", Value: orderItem.Voided_quantity + quantity},
+		{Key: "updated_at", Value: time.Now()},
+	}
+	if quantity == remaining {
+		updateObj = append(updateObj, bson.E{Key: "item_status", Value: models.ItemVoided})
+	}
+	result, err := orderItemCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "order item could not be voided"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "order item changed, try again"})
+	}
+
+	void := models.Void{
+		ID:            primitive.NewObjectID(),
+		Order_id:      order.Order_id,
+		Order_item_id: orderItem.Order_item_id,
+		Food_id:       *orderItem.Food_id,
+		Quantity:      quantity,
+		Amount:        unitPrice.Times(int64(quantity)),
+		Reason:        *request.Reason,
+		Approved_by:   currentUserId(c),
+		Created_at:    time.Now(),
+	}
+	void.Void_id = void.ID.Hex()
+	if _, err := voidCollection.InsertOne(ctx, void); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "void could not be recorded"})
+	}
+
+	if quantity == remaining {
+		publishKitchenEvent(ctx, "item_cancelled", []string{orderItem.Order_item_id})
+		if isBundle {
+			if err := cancelBundleComponents(ctx, orderItem.Order_item_id, currentUserId(c)); err != nil {
+				log.Printf("voids: components of bundle %s were not cancelled: %v", orderItem.Order_item_id, err)
+			}
+		}
+		if orderStatus(order) == models.OrderInKitchen {
+			if err := syncOrderWithKitchen(ctx, order.Order_id, currentUserId(c)); err != nil {
+				return orderTransitionError(c, err)
+			}
+		}
+	} else {
+		publishKitchenEvent(ctx, "item_updated", []string{orderItem.Order_item_id})
+	}
+	return c.JSON(void)
+}
+
+func invoiceRefunds(ctx context.Context, invoiceId string) ([]models.Refund, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	result, err := refundCollection.Find(ctx, bson.M{"invoice_id": invoiceId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	refunds := []models.Refund{}
+	err = result.All(ctx, &refunds)
+	return refunds, err
+}
+
+// refundLines prices the requested items at what was charged for them:
+// their amount after discounts plus the tax taken on top.
+func refundLines(bill helper.Bill, items []RefundItem, previous []models.Refund) ([]models.RefundLine, string) {
+	refunded := map[string]int64{}
+	for _, refund := range previous {
+		for _, line := range refund.Lines {
+			refunded[line.Order_item_id] += line.Quantity
+		}
+	}
+
+	lines := []models.RefundLine{}
+	for _, item := range items {
+		var billLine *helper.BillLine
+		for i := range bill.Lines {
+			if bill.Lines[i].Order_item_id == item.Order_item_id {
+				billLine = &bill.Lines[i]
+			}
+		}
+		if billLine == nil {
+			return nil, "order item " + item.Order_item_id + " is not on this invoice"
+		}
+
+		remaining := billLine.Quantity - refunded[item.Order_item_id]
+		quantity := item.Quantity
+		if quantity == 0 {
+			quantity = remaining
+		}
+		if quantity <= 0 || quantity > remaining {
+			return nil, "only " + strconv.FormatInt(remaining, 10) + " of " + billLine.Food_name + " can be refunded"
+		}
+		refunded[item.Order_item_id] += quantity
+
+		charged := billLine.Amount.Sub(billLine.Discount).Add(billLine.Tax)
+		lines = append(lines, models.RefundLine{
+			Order_item_id: item.Order_item_id,
+			Food_name:     billLine.Food_name,
+			Quantity:      quantity,
+			Amount:        models.Money{Amount: helper.DivRound(charged.Amount*quantity, billLine.Quantity), Currency: charged.Currency},
+		})
+	}
+	return lines, ""
+}
+
+// refundablePayment picks the payment to refund: the one asked for, or else
+// the most recent one with enough left on it. A payment can give back what it
+// took, tip included, less what was already refunded from it.
+func refundablePayment(invoice models.Invoice, previous []models.Refund, paymentId *string, amount models.Money) (models.Payment, string) {
+	left := func(payment models.Payment) int64 {
+		return payment.Amount.Add(payment.Tip).Amount - refundedSoFar(payment, previous)
+	}
+
+	if paymentId != nil {
+		for _, payment := range invoice.Payments {
+			if payment.Payment_id != *paymentId {
+				continue
+			}
+			if left(payment) < amount.Amount {
+				return payment, "only " + models.Money{Amount: left(payment), Currency: amount.Currency}.String() + " can be refunded from that payment"
+			}
+			return payment, ""
+		}
+		return models.Payment{}, "payment was not found on this invoice"
+	}
+
+	for i := len(invoice.Payments) - 1; i >= 0; i-- {
+		if left(invoice.Payments[i]) >= amount.Amount {
+			return invoice.Payments[i], ""
+		}
+	}
+	return models.Payment{}, "no single payment on this invoice has " + amount.String() + " left to refund"
+}
+
+// refundedSoFar is how much of the payment has been given back. Payments
+// taken before refunds were counted on them only have the refund records.
+func refundedSoFar(payment models.Payment, previous []models.Refund) int64 {
+	var recorded int64
+	for _, refund := range previous {
+		if refund.Payment_id == payment.Payment_id {
+			recorded += refund.Amount.Amount
+		}
+	}
+	if payment.Refunded.Amount > recorded {
+		return payment.Refunded.Amount
+	}
+	return recorded
+}
+
+// reserveRefund adds the amount to what the payment has refunded, provided
+// nobody else has refunded from it since it was read.
+func reserveRefund(ctx context.Context, invoiceId string, payment models.Payment, refunded int64, amount models.Money) (int, string) {
+	stored := interface{}(payment.Refunded.Amount)
+	if payment.Refunded.Amount == 0 {
+		stored = bson.M{"$in": bson.A{0, nil}}
+	}
+	filter := bson.M{
+		"invoice_id": invoiceId,
+		"payments":   bson.M{"$elemMatch": bson.M{"payment_id": payment.Payment_id, "refunded.amount": stored}},
+	}
+	result, err := invoiceCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "payments.$.refunded", Value: models.Money{Amount: refunded + amount.Amount, Currency: amount.Currency}},
+	}}})
+	if err != nil {
+		return http.StatusInternalServerError, "refund could not be counted against the payment"
+	}
+	if result.ModifiedCount == 0 {
+		return http.StatusConflict, "payment was refunded from at the same time, try again"
+	}
+	return 0, ""
+}
+
+// releaseRefund takes back a reserved refund that was never paid out.
+func releaseRefund(ctx context.Context, invoiceId, paymentId string, amount models.Money) {
+	filter := bson.M{"invoice_id": invoiceId, "payments.payment_id": paymentId}
+	_, err := invoiceCollection.UpdateOne(ctx, filter, bson.D{{Key: "$inc", Value: bson.D{
+		{Key: "payments.$.refunded.amount", Value: -amount.Amount},
+	}}})
+	if err != nil {
+		log.Printf("refunds: %s reserved on payment %s was not released: %v", amount, paymentId, err)
+	}
+}
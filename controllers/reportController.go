@@ -0,0 +1,346 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"golang-restaurant-management/models"
+)
+
+type ServerTips struct {
+	Server_id   string       `json:"server_id"`
+	Server_name string       `json:"server_name"`
+	Payments    int64        `json:"payments"`
+	Tips        models.Money `json:"tips"`
+}
+
+type TipReport struct {
+	From                 time.Time    `json:"from"`
+	To                   time.Time    `json:"to"`
+	Servers              []ServerTips `json:"servers"`
+	Tip_total            models.Money `json:"tip_total"`
+	Service_charge_total models.Money `json:"service_charge_total"`
+}
+
+const (
+	AdjustmentRefund = "REFUND"
+	AdjustmentVoid   = "VOID"
+)
+
+// AdjustmentLine is a refund or void as it appears in sales reports: a line
+// of its own with a negative amount, next to the sale it reverses.
+type AdjustmentLine struct {
+	Type          string       `json:"type"`
+	Adjustment_id string       `json:"adjustment_id"`
+	Invoice_id    string       `json:"invoice_id"`
+	Order_id      string       `json:"order_id"`
+	Order_item_id string       `json:"order_item_id"`
+	Description   string       `json:"description"`
+	Quantity      int64        `json:"quantity"`
+	Amount        models.Money `json:"amount"`
+	Reason        string       `json:"reason"`
+	Approved_by   string       `json:"approved_by"`
+	Created_at    time.Time    `json:"created_at"`
+}
+
+type AdjustmentReport struct {
+	From         time.Time        `json:"from"`
+	To           time.Time        `json:"to"`
+	Lines        []AdjustmentLine `json:"lines"`
+	Refund_total models.Money     `json:"refund_total"`
+	Void_total   models.Money     `json:"void_total"`
+}
+
+// GetTipReport totals the tips taken in the period for each server, and the
+// service charges on invoices settled in it.
+func GetTipReport(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	from, to, msg := reportPeriod(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	servers, err := tipsByServer(ctx, from, to)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while totalling tips"})
+	}
+	serviceCharges, err := serviceChargesSettled(ctx, from, to)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while totalling service charges"})
+	}
+
+	report := TipReport{
+		From:                 from,
+		To:                   to,
+		Servers:              servers,
+		Tip_total:            models.NewMoney(0),
+		Service_charge_total: serviceCharges,
+	}
+	for _, server := range servers {
+		report.Tip_total = report.Tip_total.Add(server.Tips)
+	}
+	return c.JSON(report)
+}
+
+// reportPeriod reads ?from= and ?to= as RFC3339 timestamps. The period
+// defaults to today so far.
+func reportPeriod(c *fiber.Ctx) (time.Time, time.Time, string) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	to := now
+
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, "from must be an RFC3339 timestamp"
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, "to must be an RFC3339 timestamp"
+		}
+		to = parsed
+	}
+	if !from.Before(to) {
+		return from, to, "from must be before to"
+	}
+	return from, to, ""
+}
+
+func tipsByServer(ctx context.Context, from, to time.Time) ([]ServerTips, error) {
+	inPeriod := bson.D{{Key: "payments.received_at", Value: bson.D{
+		{Key: "$gte", Value: from},
+		{Key: "$lt", Value: to},
+	}}}
+	matchStage := bson.D{{Key: "$match", Value: inPeriod}}
+	unwindStage := bson.D{{Key: "$unwind", Value: "$payments"}}
+	matchPaymentStage := bson.D{{Key: "$match", Value: inPeriod}}
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: "$payments.server_id"},
+		{Key: "payments", Value: bson.D{{Key: "$sum", Value: 1}}},
+		{Key: "tips", Value: bson.D{{Key: "$sum", Value: "$payments.tip.amount"}}},
+	}}}
+	lookupUserStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "user"},
+		{Key: "localField", Value: "_id"},
+		{Key: "foreignField", Value: "user_id"},
+		{Key: "as", Value: "user"},
+	}}}
+	unwindUserStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$user"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+	sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "tips", Value: -1}}}}
+
+	result, err := invoiceCollection.Aggregate(ctx, mongo.Pipeline{
+		matchStage,
+		unwindStage,
+		matchPaymentStage,
+		groupStage,
+		lookupUserStage,
+		unwindUserStage,
+		sortStage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Server_id string `bson:"_id"`
+		Payments  int64  `bson:"payments"`
+		Tips      int64  `bson:"tips"`
+		User      struct {
+			First_name string `bson:"first_name"`
+			Last_name  string `bson:"last_name"`
+		} `bson:"user"`
+	}
+	if err := result.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	servers := make([]ServerTips, 0, len(rows))
+	for _, row := range rows {
+		name := row.User.First_name
+		if row.User.Last_name != "" {
+			name += " " + row.User.Last_name
+		}
+		servers = append(servers, ServerTips{
+			Server_id:   row.Server_id,
+			Server_name: name,
+			Payments:    row.Payments,
+			Tips:        models.NewMoney(row.Tips),
+		})
+	}
+	return servers, nil
+}
+
+// An invoice counts towards the period its final payment was taken in.
+func serviceChargesSettled(ctx context.Context, from, to time.Time) (models.Money, error) {
+	total := models.NewMoney(0)
+	result, err := invoiceCollection.Find(ctx, bson.M{
+		"payment_status":       models.PaymentPaid,
+		"service_charge":       bson.M{"$ne": nil},
+		"payments.received_at": bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return total, err
+	}
+
+	var invoices []models.Invoice
+	if err := result.All(ctx, &invoices); err != nil {
+		return total, err
+	}
+
+	for _, invoice := range invoices {
+		settledAt := invoice.Payments[len(invoice.Payments)-1].Received_at
+		if settledAt.Before(from) || !settledAt.Before(to) {
+			continue
+		}
+		bill, err := invoiceBill(ctx, invoice)
+		if err != nil {
+			return total, err
+		}
+		total = total.Add(bill.Service_charge_total)
+	}
+	return total, nil
+}
+
+func GetAdjustmentReport(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	from, to, msg := reportPeriod(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	lines, err := adjustmentLines(ctx, from, to)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing refunds and voids"})
+	}
+
+	report := AdjustmentReport{
+		From:         from,
+		To:           to,
+		Lines:        lines,
+		Refund_total: models.NewMoney(0),
+		Void_total:   models.NewMoney(0),
+	}
+	for _, line := range lines {
+		if line.Type == AdjustmentRefund {
+			report.Refund_total = report.Refund_total.Add(line.Amount)
+		} else {
+			report.Void_total = report.Void_total.Add(line.Amount)
+		}
+	}
+	return c.JSON(report)
+}
+
+// adjustmentLines lists the refunds and voids made in the period, oldest
+// first. Item refunds get a line per item.
+func adjustmentLines(ctx context.Context, from, to time.Time) ([]AdjustmentLine, error) {
+	inPeriod := bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}
+	lines := []AdjustmentLine{}
+
+	var refunds []models.Refund
+	result, err := refundCollection.Find(ctx, inPeriod)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.All(ctx, &refunds); err != nil {
+		return nil, err
+	}
+	for _, refund := range refunds {
+		line := AdjustmentLine{
+			Type:          AdjustmentRefund,
+			Adjustment_id: refund.Refund_id,
+			Invoice_id:    refund.Invoice_id,
+			Order_id:      refund.Order_id,
+			Reason:        refund.Reason,
+			Approved_by:   refund.Approved_by,
+			Created_at:    refund.Created_at,
+		}
+		if len(refund.Lines) == 0 {
+			line.Description = "Refund"
+			line.Amount = models.NewMoney(0).Sub(refund.Amount)
+			lines = append(lines, line)
+			continue
+		}
+		for _, refundLine := range refund.Lines {
+			itemLine := line
+			itemLine.Order_item_id = refundLine.Order_item_id
+			itemLine.Description = refundLine.Food_name
+			itemLine.Quantity = -refundLine.Quantity
+			itemLine.Amount = models.NewMoney(0).Sub(refundLine.Amount)
+			lines = append(lines, itemLine)
+		}
+	}
+
+	var voids []models.Void
+	result, err = voidCollection.Find(ctx, inPeriod)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.All(ctx, &voids); err != nil {
+		return nil, err
+	}
+	foodNames, err := foodNames(ctx, voids)
+	if err != nil {
+		return nil, err
+	}
+	for _, void := range voids {
+		lines = append(lines, AdjustmentLine{
+			Type:          AdjustmentVoid,
+			Adjustment_id: void.Void_id,
+			Order_id:      void.Order_id,
+			Order_item_id: void.Order_item_id,
+			Description:   foodNames[void.Food_id],
+			Quantity:      -int64(void.Quantity),
+			Amount:        models.NewMoney(0).Sub(void.Amount),
+			Reason:        void.Reason,
+			Approved_by:   void.Approved_by,
+			Created_at:    void.Created_at,
+		})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Created_at.Before(lines[j].Created_at)
+	})
+	return lines, nil
+}
+
+func foodNames(ctx context.Context, voids []models.Void) (map[string]string, error) {
+	foodIds := []string{}
+	for _, void := range voids {
+		foodIds = append(foodIds, void.Food_id)
+	}
+
+	names := map[string]string{}
+	if len(foodIds) == 0 {
+		return names, nil
+	}
+	result, err := foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, err
+	}
+	var foods []models.Food
+	if err := result.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+	for _, food := range foods {
+		if food.Name != nil {
+			names[food.Food_id] = *food.Name
+		}
+	}
+	return names, nil
+}
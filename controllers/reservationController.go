@@ -0,0 +1,380 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var reservationCollection *mongo.Collection = database.OpenCollection(database.Client, "reservation")
+
+const defaultReservationMinutes = 90
+
+func GetReservations(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	if date := c.Query("date"); date != "" {
+		day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date must be formatted as YYYY-MM-DD"})
+		}
+		filter["start_time"] = bson.M{"$gte": day, "$lt": day.AddDate(0, 0, 1)}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_time", Value: 1}})
+	result, err := reservationCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing reservations"})
+	}
+
+	allReservations := []bson.M{}
+	if err := result.All(ctx, &allReservations); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(allReservations)
+}
+
+func GetReservation(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var reservation models.Reservation
+	err := reservationCollection.FindOne(ctx, bson.M{"reservation_id": c.Params("reservation_id")}).Decode(&reservation)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "reservation was not found"})
+	}
+	return c.JSON(reservation)
+}
+
+func GetTableAvailability(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	partySize, err := strconv.Atoi(c.Query("party_size"))
+	if err != nil || partySize < 1 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "party_size must be a positive number"})
+	}
+
+	start, err := time.Parse(time.RFC3339, c.Query("at"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "at must be an RFC3339 timestamp"})
+	}
+
+	duration, err := strconv.Atoi(c.Query("duration_minutes", strconv.Itoa(defaultReservationMinutes)))
+	if err != nil || duration < 15 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "duration_minutes must be at least 15"})
+	}
+
+	tables, err := findFreeTables(ctx, partySize, start, start.Add(time.Duration(duration)*time.Minute), "")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while checking availability"})
+	}
+	return c.JSON(tables)
+}
+
+func CreateReservation(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var reservation models.Reservation
+	if err := c.BodyParser(&reservation); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := validate.Struct(reservation); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if reservation.Duration_minutes == nil {
+		duration := defaultReservationMinutes
+		reservation.Duration_minutes = &duration
+	}
+	reservation.End_time = reservation.Start_time.Add(time.Duration(*reservation.Duration_minutes) * time.Minute)
+
+	tableId, status, msg := assignReservationTable(ctx, reservation, "")
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	now := time.Now()
+	reservation.ID = primitive.NewObjectID()
+	reservation.Reservation_id = reservation.ID.Hex()
+	reservation.Table_id = &tableId
+	reservation.Status = models.ReservationBooked
+	reservation.Order_id = nil
+	reservation.Seated_at = nil
+	reservation.Created_at = now
+	reservation.Updated_at = now
+
+	if _, err := reservationCollection.InsertOne(ctx, reservation); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "reservation was not created"})
+	}
+
+	// Another booking for the table may have passed the same check before
+	// either was written. Of two that clash, the one that looks last always
+	// sees the other, so backing out here keeps the table single-booked.
+	clashes, err := reservationClashes(ctx, reservation)
+	if err != nil || clashes {
+		reservationCollection.DeleteOne(ctx, bson.M{"reservation_id": reservation.Reservation_id})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "reservation was not created"})
+		}
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "table was just booked for that time, try again"})
+	}
+	return c.JSON(reservation)
+}
+
+func UpdateReservation(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	reservationId := c.Params("reservation_id")
+	var stored models.Reservation
+	if err := reservationCollection.FindOne(ctx, bson.M{"reservation_id": reservationId}).Decode(&stored); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "reservation was not found"})
+	}
+	if stored.Status != models.ReservationBooked {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "only booked reservations can be changed, reservation is " + stored.Status})
+	}
+
+	var reservation models.Reservation
+	if err := c.BodyParser(&reservation); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var updateObj primitive.D
+	rebooked := false
+
+	// Re-run the conflict check whenever the slot, the party or the table changes.
+	rebook := reservation.Party_size != nil || reservation.Start_time != nil || reservation.Duration_minutes != nil || reservation.Table_id != nil
+
+	if reservation.Status != "" {
+		if reservation.Status != models.ReservationCancelled && reservation.Status != models.ReservationNoShow {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "status can only be set to CANCELLED or NO_SHOW, use check-in to seat a party"})
+		}
+		if rebook {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "change the status on its own, not with the slot, party or table"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "status", Value: reservation.Status})
+	} else {
+		if reservation.Guest_name != nil {
+			updateObj = append(updateObj, bson.E{Key: "guest_name", Value: reservation.Guest_name})
+		}
+		if reservation.Phone != nil {
+			updateObj = append(updateObj, bson.E{Key: "phone", Value: reservation.Phone})
+		}
+
+		if rebook {
+			rebooked = true
+			if reservation.Party_size == nil {
+				reservation.Party_size = stored.Party_size
+			}
+			if reservation.Start_time == nil {
+				reservation.Start_time = stored.Start_time
+			}
+			if reservation.Duration_minutes == nil {
+				reservation.Duration_minutes = stored.Duration_minutes
+			}
+			if err := validate.Var(*reservation.Party_size, "min=1"); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "party_size must be a positive number"})
+			}
+			if err := validate.Var(*reservation.Duration_minutes, "min=15,max=480"); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "duration_minutes must be between 15 and 480"})
+			}
+			reservation.End_time = reservation.Start_time.Add(time.Duration(*reservation.Duration_minutes) * time.Minute)
+
+			// The party keeps its table unless it no longer fits them or is
+			// taken at the new time.
+			kept := reservation
+			if kept.Table_id == nil {
+				kept.Table_id = stored.Table_id
+			}
+			tableId, status, msg := assignReservationTable(ctx, kept, reservationId)
+			if msg != "" && reservation.Table_id == nil && status != http.StatusInternalServerError {
+				tableId, status, msg = assignReservationTable(ctx, reservation, reservationId)
+			}
+			if msg != "" {
+				return c.Status(status).JSON(fiber.Map{"error": msg})
+			}
+			reservation.Table_id = &tableId
+			updateObj = append(updateObj,
+				bson.E{Key: "party_size", Value: reservation.Party_size},
+				bson.E{Key: "start_time", Value: reservation.Start_time},
+				bson.E{Key: "duration_minutes", Value: reservation.Duration_minutes},
+				bson.E{Key: "end_time", Value: reservation.End_time},
+				bson.E{Key: "table_id", Value: tableId},
+			)
+		}
+	}
+
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: time.Now()})
+
+	result, err := reservationCollection.UpdateOne(ctx, bson.M{"reservation_id": reservationId}, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "reservation update failed"})
+	}
+
+	// A rebooking can race a new booking for the same table, so check again
+	// once it is written and put the old slot back if they clash.
+	if rebooked {
+		reservation.Reservation_id = reservationId
+		clashes, err := reservationClashes(ctx, reservation)
+		if err != nil || clashes {
+			reservationCollection.UpdateOne(ctx, bson.M{"reservation_id": reservationId}, bson.D{{Key: "$set", Value: bson.D{
+				{Key: "party_size", Value: stored.Party_size},
+				{Key: "start_time", Value: stored.Start_time},
+				{Key: "duration_minutes", Value: stored.Duration_minutes},
+				{Key: "end_time", Value: stored.End_time},
+				{Key: "table_id", Value: stored.Table_id},
+				{Key: "updated_at", Value: time.Now()},
+			}}})
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "reservation update failed"})
+			}
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "table was just booked for that time, try again"})
+		}
+	}
+	return c.JSON(result)
+}
+
+func CheckInReservation(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	reservationId := c.Params("reservation_id")
+	var reservation models.Reservation
+	if err := reservationCollection.FindOne(ctx, bson.M{"reservation_id": reservationId}).Decode(&reservation); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "reservation was not found"})
+	}
+	if reservation.Status != models.ReservationBooked {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "reservation is " + reservation.Status})
+	}
+
+	// Claim the reservation before seating anyone, so checking it in twice
+	// cannot open two orders.
+	now := time.Now()
+	claim := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: models.ReservationSeated},
+		{Key: "seated_at", Value: now},
+		{Key: "updated_at", Value: now},
+	}}}
+	filter := bson.M{"reservation_id": reservationId, "status": models.ReservationBooked}
+	result, err := reservationCollection.UpdateOne(ctx, filter, claim)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "reservation check-in failed"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "reservation is no longer booked"})
+	}
+
+	var order models.Order
+	order.Order_Date = now
+	order.Table_id = reservation.Table_id
+	orderId, err := OrderItemOrderCreator(order, currentUserId(c))
+	if err != nil {
+		reservationCollection.UpdateOne(ctx, bson.M{"reservation_id": reservationId, "status": models.ReservationSeated}, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: models.ReservationBooked},
+			{Key: "seated_at", Value: nil},
+			{Key: "updated_at", Value: time.Now()},
+		}}})
+		return tableError(c, err)
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "order_id", Value: orderId}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := reservationCollection.FindOneAndUpdate(ctx, bson.M{"reservation_id": reservationId}, update, opts).Decode(&reservation); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "reservation check-in failed"})
+	}
+	return c.JSON(reservation)
+}
+
+// Uses the requested table when there is one, otherwise the smallest free table
+// that seats the party. Returns an HTTP status and message when neither works.
+func assignReservationTable(ctx context.Context, reservation models.Reservation, excludeId string) (string, int, string) {
+	freeTables, err := findFreeTables(ctx, *reservation.Party_size, *reservation.Start_time, reservation.End_time, excludeId)
+	if err != nil {
+		return "", http.StatusInternalServerError, "error occurred while checking availability"
+	}
+
+	if reservation.Table_id == nil {
+		if len(freeTables) == 0 {
+			return "", http.StatusConflict, "no table seats the party at that time"
+		}
+		return freeTables[0].Table_id, 0, ""
+	}
+
+	var table models.Table
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": reservation.Table_id}).Decode(&table); err != nil {
+		return "", http.StatusNotFound, "table was not found"
+	}
+	if table.Number_of_guests == nil || *table.Number_of_guests < *reservation.Party_size {
+		return "", http.StatusConflict, "table does not seat the party"
+	}
+	for _, free := range freeTables {
+		if free.Table_id == table.Table_id {
+			return table.Table_id, 0, ""
+		}
+	}
+	return "", http.StatusConflict, "table is already reserved at that time"
+}
+
+// Whether another live reservation holds the same table for an overlapping
+// time. Used after a write, when the availability check may have been raced.
+func reservationClashes(ctx context.Context, reservation models.Reservation) (bool, error) {
+	count, err := reservationCollection.CountDocuments(ctx, bson.M{
+		"reservation_id": bson.M{"$ne": reservation.Reservation_id},
+		"table_id":       reservation.Table_id,
+		"status":         bson.M{"$in": []string{models.ReservationBooked, models.ReservationSeated}},
+		"start_time":     bson.M{"$lt": reservation.End_time},
+		"end_time":       bson.M{"$gt": *reservation.Start_time},
+	})
+	return count > 0, err
+}
+
+// Tables that seat the party and have no live reservation overlapping
+// [start, end), smallest first so large tables stay free for large parties.
+func findFreeTables(ctx context.Context, partySize int, start, end time.Time, excludeId string) ([]models.Table, error) {
+	overlap := bson.M{
+		"status":     bson.M{"$in": []string{models.ReservationBooked, models.ReservationSeated}},
+		"start_time": bson.M{"$lt": end},
+		"end_time":   bson.M{"$gt": start},
+	}
+	if excludeId != "" {
+		overlap["reservation_id"] = bson.M{"$ne": excludeId}
+	}
+
+	reservedTableIds, err := reservationCollection.Distinct(ctx, "table_id", overlap)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"number_of_guests": bson.M{"$gte": partySize},
+		"table_id":         bson.M{"$nin": reservedTableIds},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "number_of_guests", Value: 1}, {Key: "table_number", Value: 1}})
+
+	result, err := tableCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []models.Table{}
+	err = result.All(ctx, &tables)
+	return tables, err
+}
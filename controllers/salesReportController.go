@@ -0,0 +1,540 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"golang-restaurant-management/models"
+)
+
+// Sales in these reports are item sales: what was ordered at the price it
+// was captured at, less voids and cancellations, before discounts, service
+// charges and tax. They are counted when the item was ordered.
+
+type RevenueRow struct {
+	Period         string       `json:"period"`
+	Orders         int64        `json:"orders"`
+	Items          int64        `json:"items"`
+	Revenue        models.Money `json:"revenue"`
+	Average_ticket models.Money `json:"average_ticket"`
+}
+
+type SellerRow struct {
+	Key      string       `json:"key"`
+	Name     string       `json:"name"`
+	Quantity int64        `json:"quantity"`
+	Orders   int64        `json:"orders"`
+	Revenue  models.Money `json:"revenue"`
+}
+
+type ServerSalesRow struct {
+	Server_id      string       `json:"server_id"`
+	Server_name    string       `json:"server_name"`
+	Orders         int64        `json:"orders"`
+	Items          int64        `json:"items"`
+	Revenue        models.Money `json:"revenue"`
+	Average_ticket models.Money `json:"average_ticket"`
+}
+
+type TableTurnoverRow struct {
+	Table_id        string  `json:"table_id"`
+	Table_number    int64   `json:"table_number"`
+	Orders          int64   `json:"orders"`
+	Average_minutes float64 `json:"average_minutes"`
+	Shortest        float64 `json:"shortest_minutes"`
+	Longest         float64 `json:"longest_minutes"`
+}
+
+type SalesReport struct {
+	From time.Time   `json:"from"`
+	To   time.Time   `json:"to"`
+	Rows interface{} `json:"rows"`
+}
+
+// Date formats for ?group=, as understood by $dateToString.
+var reportGroupFormats = map[string]string{
+	"hour":  "%Y-%m-%dT%H:00",
+	"day":   "%Y-%m-%d",
+	"week":  "%G-W%V",
+	"month": "%Y-%m",
+}
+
+// GetRevenueReport totals sales by ?group= hour, day (the default), week,
+// month, or all for a single row over the whole period. Each row carries
+// its average ticket, the sales per order.
+func GetRevenueReport(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	from, to, msg := reportPeriod(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	group := c.Query("group", "day")
+	var period interface{} = "all"
+	if group != "all" {
+		format, ok := reportGroupFormats[group]
+		if !ok {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "group must be hour, day, week, month or all"})
+		}
+		period = bson.D{{Key: "$dateToString", Value: bson.D{
+			{Key: "format", Value: format},
+			{Key: "date", Value: "$created_at"},
+			{Key: "timezone", Value: reportTimezone()},
+		}}}
+	}
+
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: period},
+		{Key: "orders", Value: bson.D{{Key: "$addToSet", Value: "$order_id"}}},
+		{Key: "items", Value: bson.D{{Key: "$sum", Value: "$sold_quantity"}}},
+		{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$revenue"}}},
+	}}}
+	projectStage := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "orders", Value: bson.D{{Key: "$size", Value: "$orders"}}},
+		{Key: "items", Value: 1},
+		{Key: "revenue", Value: 1},
+	}}}
+	sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}}
+
+	var results []struct {
+		Period  string `bson:"_id"`
+		Orders  int64  `bson:"orders"`
+		Items   int64  `bson:"items"`
+		Revenue int64  `bson:"revenue"`
+	}
+	if err := aggregateSales(ctx, from, to, &results, groupStage, projectStage, sortStage); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while totalling revenue"})
+	}
+
+	rows := []RevenueRow{}
+	records := [][]string{}
+	for _, result := range results {
+		row := RevenueRow{
+			Period:         result.Period,
+			Orders:         result.Orders,
+			Items:          result.Items,
+			Revenue:        models.NewMoney(result.Revenue),
+			Average_ticket: averageTicket(result.Revenue, result.Orders),
+		}
+		rows = append(rows, row)
+		records = append(records, []string{
+			row.Period,
+			strconv.FormatInt(row.Orders, 10),
+			strconv.FormatInt(row.Items, 10),
+			row.Revenue.Decimal(),
+			row.Average_ticket.Decimal(),
+		})
+	}
+	header := []string{"period", "orders", "items", "revenue", "average_ticket"}
+	return sendReport(c, "revenue", SalesReport{From: from, To: to, Rows: rows}, header, records)
+}
+
+// GetSellersReport ranks what sold. ?by= is food (the default) or category,
+// the menu the food is on; ?order= is top (the default) or bottom; ?sort= is
+// quantity (the default) or revenue; ?limit= caps the rows, 10 by default.
+func GetSellersReport(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	from, to, msg := reportPeriod(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	direction := -1
+	switch c.Query("order", "top") {
+	case "top":
+	case "bottom":
+		direction = 1
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "order must be top or bottom"})
+	}
+	sortBy := c.Query("sort", "quantity")
+	if sortBy != "quantity" && sortBy != "revenue" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "sort must be quantity or revenue"})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+
+	var stages []bson.D
+	switch c.Query("by", "food") {
+	case "food":
+		stages = append(stages, bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$food_id"},
+			{Key: "name", Value: bson.D{{Key: "$first", Value: "$food.name"}}},
+			{Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$sold_quantity"}}},
+			{Key: "orders", Value: bson.D{{Key: "$addToSet", Value: "$order_id"}}},
+			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$revenue"}}},
+		}}})
+	case "category":
+		stages = append(stages,
+			bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "menu"},
+				{Key: "localField", Value: "food.menu_id"},
+				{Key: "foreignField", Value: "menu_id"},
+				{Key: "as", Value: "menu"},
+			}}},
+			bson.D{{Key: "$unwind", Value: bson.D{
+				{Key: "path", Value: "$menu"},
+				{Key: "preserveNullAndEmptyArrays", Value: true},
+			}}},
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$menu.category", ""}}}},
+				{Key: "name", Value: bson.D{{Key: "$first", Value: "$menu.category"}}},
+				{Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$sold_quantity"}}},
+				{Key: "orders", Value: bson.D{{Key: "$addToSet", Value: "$order_id"}}},
+				{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$revenue"}}},
+			}}},
+		)
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "by must be food or category"})
+	}
+	stages = append(stages,
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "name", Value: 1},
+			{Key: "quantity", Value: 1},
+			{Key: "orders", Value: bson.D{{Key: "$size", Value: "$orders"}}},
+			{Key: "revenue", Value: 1},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{
+			{Key: sortBy, Value: direction},
+			{Key: "_id", Value: 1},
+		}}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+
+	var results []struct {
+		Key      string `bson:"_id"`
+		Name     string `bson:"name"`
+		Quantity int64  `bson:"quantity"`
+		Orders   int64  `bson:"orders"`
+		Revenue  int64  `bson:"revenue"`
+	}
+	if err := aggregateSales(ctx, from, to, &results, stages...); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while ranking sellers"})
+	}
+
+	rows := []SellerRow{}
+	records := [][]string{}
+	for _, result := range results {
+		row := SellerRow{
+			Key:      result.Key,
+			Name:     result.Name,
+			Quantity: result.Quantity,
+			Orders:   result.Orders,
+			Revenue:  models.NewMoney(result.Revenue),
+		}
+		rows = append(rows, row)
+		records = append(records, []string{
+			row.Key,
+			row.Name,
+			strconv.FormatInt(row.Quantity, 10),
+			strconv.FormatInt(row.Orders, 10),
+			row.Revenue.Decimal(),
+		})
+	}
+	header := []string{"key", "name", "quantity", "orders", "revenue"}
+	return sendReport(c, "sellers", SalesReport{From: from, To: to, Rows: rows}, header, records)
+}
+
+// GetServerSalesReport totals sales for each order's server.
+func GetServerSalesReport(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	from, to, msg := reportPeriod(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$order.server_id", ""}}}},
+		{Key: "orders", Value: bson.D{{Key: "$addToSet", Value: "$order_id"}}},
+		{Key: "items", Value: bson.D{{Key: "$sum", Value: "$sold_quantity"}}},
+		{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$revenue"}}},
+	}}}
+	lookupUserStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "user"},
+		{Key: "localField", Value: "_id"},
+		{Key: "foreignField", Value: "user_id"},
+		{Key: "as", Value: "user"},
+	}}}
+	unwindUserStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$user"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+	projectStage := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "orders", Value: bson.D{{Key: "$size", Value: "$orders"}}},
+		{Key: "items", Value: 1},
+		{Key: "revenue", Value: 1},
+		{Key: "user.first_name", Value: 1},
+		{Key: "user.last_name", Value: 1},
+	}}}
+	sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "revenue", Value: -1}}}}
+
+	var results []struct {
+		Server_id string `bson:"_id"`
+		Orders    int64  `bson:"orders"`
+		Items     int64  `bson:"items"`
+		Revenue   int64  `bson:"revenue"`
+		User      struct {
+			First_name string `bson:"first_name"`
+			Last_name  string `bson:"last_name"`
+		} `bson:"user"`
+	}
+	err := aggregateSales(ctx, from, to, &results, groupStage, lookupUserStage, unwindUserStage, projectStage, sortStage)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while totalling server sales"})
+	}
+
+	rows := []ServerSalesRow{}
+	records := [][]string{}
+	for _, result := range results {
+		name := result.User.First_name
+		if result.User.Last_name != "" {
+			name += " " + result.User.Last_name
+		}
+		row := ServerSalesRow{
+			Server_id:      result.Server_id,
+			Server_name:    name,
+			Orders:         result.Orders,
+			Items:          result.Items,
+			Revenue:        models.NewMoney(result.Revenue),
+			Average_ticket: averageTicket(result.Revenue, result.Orders),
+		}
+		rows = append(rows, row)
+		records = append(records, []string{
+			row.Server_id,
+			row.Server_name,
+			strconv.FormatInt(row.Orders, 10),
+			strconv.FormatInt(row.Items, 10),
+			row.Revenue.Decimal(),
+			row.Average_ticket.Decimal(),
+		})
+	}
+	header := []string{"server_id", "server_name", "orders", "items", "revenue", "average_ticket"}
+	return sendReport(c, "servers", SalesReport{From: from, To: to, Rows: rows}, header, records)
+}
+
+// GetTableTurnoverReport measures how long each table's paid orders took,
+// from the order being opened to it being paid.
+func GetTableTurnoverReport(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	from, to, msg := reportPeriod(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	matchStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "created_at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+		{Key: "order_status", Value: models.OrderPaid},
+	}}}
+	paidAt := bson.D{{Key: "$arrayElemAt", Value: bson.A{
+		bson.D{{Key: "$filter", Value: bson.D{
+			{Key: "input", Value: "$status_history"},
+			{Key: "as", Value: "change"},
+			{Key: "cond", Value: bson.D{{Key: "$eq", Value: bson.A{"$$change.to", models.OrderPaid}}}},
+		}}},
+		-1,
+	}}}
+	addFieldsStage := bson.D{{Key: "$addFields", Value: bson.D{
+		{Key: "minutes", Value: bson.D{{Key: "$divide", Value: bson.A{
+			bson.D{{Key: "$subtract", Value: bson.A{
+				bson.D{{Key: "$let", Value: bson.D{
+					{Key: "vars", Value: bson.D{{Key: "paid", Value: paidAt}}},
+					{Key: "in", Value: "$$paid.changed_at"},
+				}}},
+				"$created_at",
+			}}},
+			60000,
+		}}}},
+	}}}
+	// Orders paid before status history was kept have no time to measure.
+	measuredStage := bson.D{{Key: "$match", Value: bson.D{{Key: "minutes", Value: bson.D{{Key: "$ne", Value: nil}}}}}}
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: "$table_id"},
+		{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+		{Key: "average_minutes", Value: bson.D{{Key: "$avg", Value: "$minutes"}}},
+		{Key: "shortest", Value: bson.D{{Key: "$min", Value: "$minutes"}}},
+		{Key: "longest", Value: bson.D{{Key: "$max", Value: "$minutes"}}},
+	}}}
+	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "table"},
+		{Key: "localField", Value: "_id"},
+		{Key: "foreignField", Value: "table_id"},
+		{Key: "as", Value: "table"},
+	}}}
+	unwindTableStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$table"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+	sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "table.table_number", Value: 1}}}}
+
+	result, err := orderCollection.Aggregate(ctx, mongo.Pipeline{
+		matchStage,
+		addFieldsStage,
+		measuredStage,
+		groupStage,
+		lookupTableStage,
+		unwindTableStage,
+		sortStage,
+	})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while measuring table turnover"})
+	}
+
+	var results []struct {
+		Table_id        string  `bson:"_id"`
+		Orders          int64   `bson:"orders"`
+		Average_minutes float64 `bson:"average_minutes"`
+		Shortest        float64 `bson:"shortest"`
+		Longest         float64 `bson:"longest"`
+		Table           struct {
+			Table_number int64 `bson:"table_number"`
+		} `bson:"table"`
+	}
+	if err := result.All(ctx, &results); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while measuring table turnover"})
+	}
+
+	rows := []TableTurnoverRow{}
+	records := [][]string{}
+	for _, result := range results {
+		row := TableTurnoverRow{
+			Table_id:        result.Table_id,
+			Table_number:    result.Table.Table_number,
+			Orders:          result.Orders,
+			Average_minutes: roundMinutes(result.Average_minutes),
+			Shortest:        roundMinutes(result.Shortest),
+			Longest:         roundMinutes(result.Longest),
+		}
+		rows = append(rows, row)
+		records = append(records, []string{
+			row.Table_id,
+			strconv.FormatInt(row.Table_number, 10),
+			strconv.FormatInt(row.Orders, 10),
+			strconv.FormatFloat(row.Average_minutes, 'f', 1, 64),
+			strconv.FormatFloat(row.Shortest, 'f', 1, 64),
+			strconv.FormatFloat(row.Longest, 'f', 1, 64),
+		})
+	}
+	header := []string{"table_id", "table_number", "orders", "average_minutes", "shortest_minutes", "longest_minutes"}
+	return sendReport(c, "table-turnover", SalesReport{From: from, To: to, Rows: rows}, header, records)
+}
+
+// aggregateSales runs the stages over the period's sold items. Each item
+// reaching them has its order and food joined, sold_quantity (less voids)
+// and revenue in minor units. A bundle is sold as one item, so the
+// components cooked for it are left out.
+func aggregateSales(ctx context.Context, from, to time.Time, results interface{}, stages ...bson.D) error {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "created_at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+		{Key: "item_status", Value: bson.D{{Key: "$nin", Value: unbilledItemStatuses}}},
+		{Key: "bundle_item_id", Value: nil},
+	}}}
+	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "order"},
+		{Key: "localField", Value: "order_id"},
+		{Key: "foreignField", Value: "order_id"},
+		{Key: "as", Value: "order"},
+	}}}
+	unwindOrderStage := bson.D{{Key: "$unwind", Value: "$order"}}
+	matchOrderStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "order.order_status", Value: bson.D{{Key: "$ne", Value: models.OrderCancelled}}},
+	}}}
+	lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "food"},
+		{Key: "localField", Value: "food_id"},
+		{Key: "foreignField", Value: "food_id"},
+		{Key: "as", Value: "food"},
+	}}}
+	unwindFoodStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$food"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	quantity := bson.D{{Key: "$subtract", Value: bson.A{
+		bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$isNumber", Value: "$quantity"}}, "$quantity", 1,
+		}}},
+		bson.D{{Key: "$ifNull", Value: bson.A{"$voided_quantity", 0}}},
+	}}}
+	unitAmount := bson.D{{Key: "$ifNull", Value: bson.A{"$unit_price.amount", "$food.price.amount", 0}}}
+	addQuantityStage := bson.D{{Key: "$addFields", Value: bson.D{{Key: "sold_quantity", Value: quantity}}}}
+	addRevenueStage := bson.D{{Key: "$addFields", Value: bson.D{
+		{Key: "revenue", Value: bson.D{{Key: "$multiply", Value: bson.A{"$sold_quantity", unitAmount}}}},
+	}}}
+
+	pipeline := mongo.Pipeline{
+		matchStage,
+		lookupOrderStage,
+		unwindOrderStage,
+		matchOrderStage,
+		lookupFoodStage,
+		unwindFoodStage,
+		addQuantityStage,
+		addRevenueStage,
+	}
+	pipeline = append(pipeline, stages...)
+
+	result, err := orderItemCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return result.All(ctx, results)
+}
+
+// sendReport answers with the report as JSON, or as CSV rows when the
+// request asks for ?format=csv.
+func sendReport(c *fiber.Ctx, name string, report SalesReport, header []string, records [][]string) error {
+	switch c.Query("format", "json") {
+	case "json":
+		return c.JSON(report)
+	case "csv":
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be json or csv"})
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(header)
+	w.WriteAll(records)
+	if err := w.Error(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while writing the report"})
+	}
+
+	filename := name + "-" + report.From.Format(businessDateLayout) + "-" + report.To.Format(businessDateLayout) + ".csv"
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename=\""+filename+"\"")
+	return c.Send(b.Bytes())
+}
+
+func averageTicket(revenue, orders int64) models.Money {
+	if orders == 0 {
+		return models.NewMoney(0)
+	}
+	return models.NewMoney((revenue + orders/2) / orders)
+}
+
+func roundMinutes(minutes float64) float64 {
+	return float64(int64(minutes*10+0.5)) / 10
+}
+
+// Periods are grouped in the server's local time, at its current offset.
+func reportTimezone() string {
+	return time.Now().Format("-07:00")
+}
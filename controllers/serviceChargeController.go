@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var serviceChargeCollection *mongo.Collection = database.OpenCollection(database.Client, "serviceCharge")
+
+func GetServiceCharges(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "min_guests", Value: 1}})
+	result, err := serviceChargeCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing service charges"})
+	}
+
+	rules := []models.ServiceChargeRule{}
+	if err := result.All(ctx, &rules); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rules)
+}
+
+func CreateServiceCharge(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var rule models.ServiceChargeRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if rule.Active == nil {
+		active := true
+		rule.Active = &active
+	}
+
+	now := time.Now()
+	rule.ID = primitive.NewObjectID()
+	rule.Service_charge_id = rule.ID.Hex()
+	rule.Created_at = now
+	rule.Updated_at = now
+
+	if _, err := serviceChargeCollection.InsertOne(ctx, rule); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "service charge was not created"})
+	}
+	return c.JSON(rule)
+}
+
+// Changes only affect invoices created afterwards; existing invoices keep a
+// copy of the rule that applied to them.
+func UpdateServiceCharge(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var rule models.ServiceChargeRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var updateObj primitive.D
+	if rule.Name != nil {
+		updateObj = append(updateObj, bson.E{Key: "name", Value: rule.Name})
+	}
+	if rule.Rate_bps != nil {
+		if err := validate.Var(*rule.Rate_bps, "min=1,max=10000"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "rate_bps must be between 1 and 10000"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "rate_bps", Value: rule.Rate_bps})
+	}
+	if rule.Min_guests != nil {
+		if err := validate.Var(*rule.Min_guests, "min=1"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "min_guests must be at least 1"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "min_guests", Value: rule.Min_guests})
+	}
+	if rule.Active != nil {
+		updateObj = append(updateObj, bson.E{Key: "active", Value: rule.Active})
+	}
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: time.Now()})
+
+	filter := bson.M{"service_charge_id": c.Params("service_charge_id")}
+	result, err := serviceChargeCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "service charge update failed"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "service charge was not found"})
+	}
+	return c.JSON(result)
+}
+
+// serviceChargeFor picks the active rule with the highest threshold the
+// order's table meets, or nil when none applies.
+func serviceChargeFor(ctx context.Context, order models.Order) (*models.InvoiceServiceCharge, error) {
+	if order.Table_id == nil {
+		return nil, nil
+	}
+
+	var table models.Table
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": *order.Table_id}).Decode(&table); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if table.Number_of_guests == nil {
+		return nil, nil
+	}
+	guests := *table.Number_of_guests
+
+	var rule models.ServiceChargeRule
+	filter := bson.M{"active": bson.M{"$ne": false}, "min_guests": bson.M{"$lte": guests}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "min_guests", Value: -1}})
+	if err := serviceChargeCollection.FindOne(ctx, filter, opts).Decode(&rule); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &models.InvoiceServiceCharge{
+		Service_charge_id: rule.Service_charge_id,
+		Name:              *rule.Name,
+		Rate_bps:          *rule.Rate_bps,
+		Guests:            guests,
+	}, nil
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var stationCollection *mongo.Collection = database.OpenCollection(database.Client, "station")
+
+func GetStations(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	result, err := stationCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing stations"})
+	}
+
+	stations := []models.Station{}
+	if err := result.All(ctx, &stations); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(stations)
+}
+
+func CreateStation(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var station models.Station
+	if err := c.BodyParser(&station); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(station); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if station.Default == nil {
+		isDefault := false
+		station.Default = &isDefault
+	}
+
+	now := time.Now()
+	station.ID = primitive.NewObjectID()
+	station.Station_id = station.ID.Hex()
+	station.Created_at = now
+	station.Updated_at = now
+
+	if *station.Default {
+		if err := clearDefaultStation(ctx); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "station was not created"})
+		}
+	}
+	if _, err := stationCollection.InsertOne(ctx, station); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "station was not created"})
+	}
+	return c.JSON(station)
+}
+
+func UpdateStation(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var station models.Station
+	if err := c.BodyParser(&station); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var updateObj primitive.D
+	if station.Name != nil {
+		if err := validate.Var(*station.Name, "min=2,max=64"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name must be 2 to 64 characters"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "name", Value: *station.Name})
+	}
+	if station.Printer_address != nil {
+		if *station.Printer_address != "" {
+			if err := validate.Var(*station.Printer_address, "hostname_port"); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "printer_address must be host:port"})
+			}
+		}
+		updateObj = append(updateObj, bson.E{Key: "printer_address", Value: *station.Printer_address})
+	}
+	if station.Default != nil {
+		updateObj = append(updateObj, bson.E{Key: "default", Value: *station.Default})
+	}
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: time.Now()})
+
+	filter := bson.M{"station_id": c.Params("station_id")}
+	if count, err := stationCollection.CountDocuments(ctx, filter); err != nil || count == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "station was not found"})
+	}
+	if station.Default != nil && *station.Default {
+		if err := clearDefaultStation(ctx); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "station update failed"})
+		}
+	}
+
+	var updated models.Station
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := stationCollection.FindOneAndUpdate(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, opts).Decode(&updated)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "station update failed"})
+	}
+	return c.JSON(updated)
+}
+
+// Only one station takes the foods that name none.
+func clearDefaultStation(ctx context.Context) error {
+	_, err := stationCollection.UpdateMany(ctx, bson.M{"default": true}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "default", Value: false},
+		{Key: "updated_at", Value: time.Now()},
+	}}})
+	return err
+}
+
+func stationExists(ctx context.Context, stationId string) bool {
+	count, err := stationCollection.CountDocuments(ctx, bson.M{"station_id": stationId})
+	return err == nil && count > 0
+}
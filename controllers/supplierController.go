@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var supplierCollection *mongo.Collection = database.OpenCollection(database.Client, "supplier")
+
+type PriceListRequest struct {
+	Prices []models.SupplierPrice `json:"prices" validate:"dive"`
+}
+
+func GetSuppliers(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if ingredientId := c.Query("ingredient_id"); ingredientId != "" {
+		filter["prices.ingredient_id"] = ingredientId
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	result, err := supplierCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing suppliers"})
+	}
+
+	suppliers := []models.Supplier{}
+	if err := result.All(ctx, &suppliers); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(suppliers)
+}
+
+func GetSupplier(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var supplier models.Supplier
+	err := supplierCollection.FindOne(ctx, bson.M{"supplier_id": c.Params("supplier_id")}).Decode(&supplier)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "supplier was not found"})
+	}
+	return c.JSON(supplier)
+}
+
+func CreateSupplier(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var supplier models.Supplier
+	if err := c.BodyParser(&supplier); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(supplier); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if supplier.Prices == nil {
+		supplier.Prices = []models.SupplierPrice{}
+	}
+	if msg := checkPriceList(ctx, supplier.Prices); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	now := time.Now()
+	supplier.ID = primitive.NewObjectID()
+	supplier.Supplier_id = supplier.ID.Hex()
+	supplier.Created_at = now
+	supplier.Updated_at = now
+
+	if _, err := supplierCollection.InsertOne(ctx, supplier); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "supplier was not created"})
+	}
+	return c.JSON(supplier)
+}
+
+func UpdateSupplier(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var supplier models.Supplier
+	if err := c.BodyParser(&supplier); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var updateObj primitive.D
+	if supplier.Name != nil {
+		if err := validate.Var(*supplier.Name, "min=2,max=100"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name must be 2 to 100 characters"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "name", Value: *supplier.Name})
+	}
+	if supplier.Contact_name != nil {
+		updateObj = append(updateObj, bson.E{Key: "contact_name", Value: *supplier.Contact_name})
+	}
+	if supplier.Email != nil {
+		if err := validate.Var(*supplier.Email, "omitempty,email"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "email is not valid"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "email", Value: *supplier.Email})
+	}
+	if supplier.Phone != nil {
+		updateObj = append(updateObj, bson.E{Key: "phone", Value: *supplier.Phone})
+	}
+	if supplier.Lead_time_days != nil {
+		if err := validate.Var(*supplier.Lead_time_days, "min=0,max=60"); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lead_time_days must be between 0 and 60"})
+		}
+		updateObj = append(updateObj, bson.E{Key: "lead_time_days", Value: *supplier.Lead_time_days})
+	}
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: time.Now()})
+
+	return updateSupplier(ctx, c, updateObj)
+}
+
+// SetSupplierPrices replaces the supplier's price list. Purchase orders
+// already raised keep the prices they were raised at.
+func SetSupplierPrices(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var request PriceListRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if request.Prices == nil {
+		request.Prices = []models.SupplierPrice{}
+	}
+	if msg := checkPriceList(ctx, request.Prices); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	return updateSupplier(ctx, c, primitive.D{
+		{Key: "prices", Value: request.Prices},
+		{Key: "updated_at", Value: time.Now()},
+	})
+}
+
+func updateSupplier(ctx context.Context, c *fiber.Ctx, updateObj primitive.D) error {
+	var updated models.Supplier
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := supplierCollection.FindOneAndUpdate(ctx,
+		bson.M{"supplier_id": c.Params("supplier_id")},
+		bson.D{{Key: "$set", Value: updateObj}},
+		opts,
+	).Decode(&updated)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "supplier was not found"})
+	}
+	return c.JSON(updated)
+}
+
+// A price list names each ingredient once, in the restaurant's currency.
+func checkPriceList(ctx context.Context, prices []models.SupplierPrice) string {
+	currency := models.DefaultCurrency()
+	ingredientIds := []string{}
+	seen := map[string]bool{}
+	for _, price := range prices {
+		if seen[price.Ingredient_id] {
+			return "ingredient " + price.Ingredient_id + " is priced twice"
+		}
+		seen[price.Ingredient_id] = true
+		if price.Unit_price.Currency != currency || price.Unit_price.Amount < 0 {
+			return "unit prices must be in " + currency + " and cannot be negative"
+		}
+		ingredientIds = append(ingredientIds, price.Ingredient_id)
+	}
+	if len(ingredientIds) == 0 {
+		return ""
+	}
+
+	count, err := ingredientCollection.CountDocuments(ctx, bson.M{"ingredient_id": bson.M{"$in": ingredientIds}})
+	if err != nil || count != int64(len(ingredientIds)) {
+		return "price list names an ingredient that was not found"
+	}
+	return ""
+}
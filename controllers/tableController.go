@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	//"fmt"
 	"golang-restaurant-management/database"
 	"golang-restaurant-management/models"
@@ -17,6 +18,11 @@ import (
 
 var tableCollection *mongo.Collection = database.OpenCollection(database.Client, "table")
 
+var (
+	errTableNotFound = errors.New("table was not found")
+	errTableTaken    = errors.New("table already has an open order")
+)
+
 func GetTables(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
@@ -65,6 +71,10 @@ func CreateTable(c *fiber.Ctx) error {
 	now := time.Now().UTC()
 	table.Created_at = now
 	table.Updated_at = now
+	status := models.TableFree
+	table.Table_status = &status
+	table.Current_order_id = nil
+	table.Seated_at = nil
 
 	result, err := tableCollection.InsertOne(ctx, table)
 	if err != nil {
@@ -85,18 +95,164 @@ func UpdateTable(c *fiber.Ctx) error {
 
 	var updateObj primitive.D
 	if table.Number_of_guests != nil {
-		updateObj = append(updateObj, bson.E{"number_of_guests", table.Number_of_guests})
+		updateObj = append(updateObj, bson.E{Key: "number_of_guests", Value: table.Number_of_guests})
 	}
 	if table.Table_number != nil {
-		updateObj = append(updateObj, bson.E{"table_number", table.Table_number})
+		updateObj = append(updateObj, bson.E{Key: "table_number", Value: table.Table_number})
 	}
 	table.Updated_at = time.Now().UTC()
-	updateObj = append(updateObj, bson.E{"updated_at", table.Updated_at})
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: table.Updated_at})
 
 	opts := options.Update().SetUpsert(true)
-	result, err := tableCollection.UpdateOne(ctx, bson.M{"table_id": tableId}, bson.D{{"$set", updateObj}}, opts)
+	result, err := tableCollection.UpdateOne(ctx, bson.M{"table_id": tableId}, bson.D{{Key: "$set", Value: updateObj}}, opts)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "table update failed"})
 	}
 	return c.JSON(result)
 }
+
+func UpdateTableStatus(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var body struct {
+		Table_status string `json:"table_status" validate:"required,eq=FREE|eq=RESERVED|eq=CLEANING"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Occupied tables are released by settling or cancelling their order. The
+	// check is part of the update so an order seated meanwhile is not wiped.
+	tableId := c.Params("table_id")
+	filter := bson.M{"table_id": tableId, "table_status": bson.M{"$ne": models.TableOccupied}}
+	result, err := tableCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "table_status", Value: body.Table_status},
+		{Key: "current_order_id", Value: nil},
+		{Key: "seated_at", Value: nil},
+		{Key: "updated_at", Value: time.Now().UTC()},
+	}}})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "table update failed"})
+	}
+	if result.MatchedCount == 0 {
+		count, err := tableCollection.CountDocuments(ctx, bson.M{"table_id": tableId})
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "table update failed"})
+		}
+		if count == 0 {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "table was not found"})
+		}
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "table has an open order"})
+	}
+	return c.JSON(result)
+}
+
+func GetFloorOverview(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "table_number", Value: 1}})
+	result, err := tableCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing tables"})
+	}
+
+	var tables []models.Table
+	if err := result.All(ctx, &tables); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	floor := []fiber.Map{}
+	for _, table := range tables {
+		status := models.TableFree
+		if table.Table_status != nil {
+			status = *table.Table_status
+		}
+
+		entry := fiber.Map{
+			"table_id":         table.Table_id,
+			"table_number":     table.Table_number,
+			"number_of_guests": table.Number_of_guests,
+			"table_status":     status,
+			"current_order_id": table.Current_order_id,
+			"seated_at":        table.Seated_at,
+			"running_bill":     models.NewMoney(0),
+			"item_count":       0,
+		}
+
+		if status == models.TableOccupied && table.Current_order_id != nil {
+			allOrderItems, err := ItemsByOrder(*table.Current_order_id)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "unable to fetch order items"})
+			}
+			if len(allOrderItems) > 0 {
+				entry["running_bill"] = moneyFromResult(allOrderItems[0]["payment_due"])
+				entry["item_count"] = allOrderItems[0]["total_count"]
+			}
+		}
+
+		floor = append(floor, entry)
+	}
+
+	return c.JSON(floor)
+}
+
+// Seats an order at a table. A table can only hold one open order, so this
+// fails with errTableTaken when another order got there first.
+func occupyTable(ctx context.Context, tableId *string, orderId string, seatedAt time.Time) error {
+	if tableId == nil {
+		return nil
+	}
+	filter := bson.M{"table_id": tableId, "table_status": bson.M{"$ne": models.TableOccupied}}
+	result, err := tableCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "table_status", Value: models.TableOccupied},
+		{Key: "current_order_id", Value: orderId},
+		{Key: "seated_at", Value: seatedAt},
+		{Key: "updated_at", Value: time.Now().UTC()},
+	}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		count, err := tableCollection.CountDocuments(ctx, bson.M{"table_id": tableId})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return errTableNotFound
+		}
+		return errTableTaken
+	}
+	return nil
+}
+
+// Moves the table on from an order that is finished. Tables that have
+// already been given to a newer order are left alone.
+func releaseTable(ctx context.Context, orderId, status string) error {
+	return vacateTable(ctx, bson.M{"current_order_id": orderId}, status)
+}
+
+func vacateTable(ctx context.Context, filter bson.M, status string) error {
+	_, err := tableCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "table_status", Value: status},
+		{Key: "current_order_id", Value: nil},
+		{Key: "seated_at", Value: nil},
+		{Key: "updated_at", Value: time.Now().UTC()},
+	}}})
+	return err
+}
+
+func tableError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errTableNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errTableTaken):
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "table status update failed"})
+	}
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+	"golang-restaurant-management/models"
+)
+
+var taxRuleCollection *mongo.Collection = database.OpenCollection(database.Client, "taxRule")
+
+var errTaxRuleChanged = errors.New("tax rule was changed concurrently, retry")
+
+func GetTaxRules(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "at must be an RFC3339 timestamp"})
+		}
+		at = parsed
+	}
+
+	rules, err := taxRulesAt(ctx, at)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while listing tax rules"})
+	}
+	return c.JSON(rules)
+}
+
+func GetTaxRule(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	result, err := taxRuleCollection.Find(ctx, bson.M{"tax_id": c.Params("tax_id")}, opts)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "error occurred while fetching the tax rule"})
+	}
+
+	var versions []models.TaxRule
+	if err := result.All(ctx, &versions); err != nil || len(versions) == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "tax rule was not found"})
+	}
+	return c.JSON(versions)
+}
+
+func CreateTaxRule(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var rule models.TaxRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(rule); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now()
+	rule.ID = primitive.NewObjectID()
+	rule.Tax_rule_id = rule.ID.Hex()
+	rule.Tax_id = rule.ID.Hex()
+	rule.Version = 1
+	rule.Effective_from = now
+	rule.Effective_to = nil
+	rule.Created_by = currentUserId(c)
+	rule.Created_at = now
+	if rule.Inclusive == nil {
+		inclusive := false
+		rule.Inclusive = &inclusive
+	}
+
+	if _, err := taxRuleCollection.InsertOne(ctx, rule); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "tax rule was not created"})
+	}
+	return c.JSON(rule)
+}
+
+// UpdateTaxRule never edits a version in place: it inserts the next version
+// with the changes applied and closes the current one.
+func UpdateTaxRule(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	taxId := c.Params("tax_id")
+	current, err := currentTaxRule(ctx, taxId)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "tax rule was not found"})
+	}
+
+	var changes models.TaxRule
+	if err := c.BodyParser(&changes); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	next := current
+	if changes.Name != nil {
+		next.Name = changes.Name
+	}
+	if changes.Rate_bps != nil {
+		next.Rate_bps = changes.Rate_bps
+	}
+	if changes.Inclusive != nil {
+		next.Inclusive = changes.Inclusive
+	}
+	if changes.Categories != nil {
+		next.Categories = changes.Categories
+	}
+	if err := validate.Struct(next); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now()
+	next.ID = primitive.NewObjectID()
+	next.Tax_rule_id = next.ID.Hex()
+	next.Version = current.Version + 1
+	next.Effective_from = now
+	next.Effective_to = nil
+	next.Created_by = currentUserId(c)
+	next.Created_at = now
+
+	// The new version goes in first so a failure part way never leaves the
+	// tax without an open version. If the old one cannot be closed, the new
+	// one is taken back out.
+	if _, err := taxRuleCollection.InsertOne(ctx, next); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "tax rule update failed"})
+	}
+	if err := closeTaxRule(ctx, current, now); err != nil {
+		if _, deleteErr := taxRuleCollection.DeleteOne(ctx, bson.M{"tax_rule_id": next.Tax_rule_id}); deleteErr != nil {
+			log.Printf("tax rules: version %s of %s was not removed: %v", next.Tax_rule_id, taxId, deleteErr)
+		}
+		if errors.Is(err, errTaxRuleChanged) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "tax rule update failed"})
+	}
+	return c.JSON(next)
+}
+
+func RetireTaxRule(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	current, err := currentTaxRule(ctx, c.Params("tax_id"))
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "tax rule was not found"})
+	}
+	if err := closeTaxRule(ctx, current, time.Now()); err != nil {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "tax rule retired"})
+}
+
+func currentTaxRule(ctx context.Context, taxId string) (models.TaxRule, error) {
+	// While an update is in flight the old and new versions are both open;
+	// the newer one is current.
+	var rule models.TaxRule
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := taxRuleCollection.FindOne(ctx, bson.M{"tax_id": taxId, "effective_to": nil}, opts).Decode(&rule)
+	return rule, err
+}
+
+func closeTaxRule(ctx context.Context, rule models.TaxRule, at time.Time) error {
+	result, err := taxRuleCollection.UpdateOne(
+		ctx,
+		bson.M{"tax_rule_id": rule.Tax_rule_id, "effective_to": nil},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "effective_to", Value: at}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return errTaxRuleChanged
+	}
+	return nil
+}
+
+func taxRulesAt(ctx context.Context, at time.Time) ([]models.TaxRule, error) {
+	filter := bson.M{
+		"effective_from": bson.M{"$lte": at},
+		"$or": bson.A{
+			bson.M{"effective_to": nil},
+			bson.M{"effective_to": bson.M{"$gt": at}},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	result, err := taxRuleCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []models.TaxRule{}
+	err = result.All(ctx, &rules)
+	return rules, err
+}
@@ -95,14 +95,26 @@ func SignUp(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Phone already exists"})
 	}
 
-	token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id)
-	
+	// Roles are granted by an admin; only the very first account bootstraps as ADMIN.
+	role := models.RoleWaiter
+	count, err = userCollection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User could not be created"})
+	}
+	if count == 0 {
+		role = models.RoleAdmin
+	}
+	user.Role = &role
+
 	hashedPassword := HashPassword(*user.Password)
 	user.Password = &hashedPassword
 	user.Created_at = time.Now()
 	user.Updated_at = time.Now()
 	user.ID = primitive.NewObjectID()
 	user.User_id = user.ID.Hex()
+
+	familyId := helper.NewTokenFamily()
+	token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id, role, familyId)
 	user.Token = &token
 	user.Refresh_Token = &refreshToken
 
@@ -135,12 +147,123 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": msg})
 	}
 
-	token, refreshToken, _ := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id)
+	role := models.RoleWaiter
+	if foundUser.Role != nil {
+		role = *foundUser.Role
+	}
+	foundUser.Role = &role
+
+	// Every login is its own session with its own refresh token family.
+	familyId := helper.NewTokenFamily()
+	token, refreshToken, err := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id, role, familyId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate tokens"})
+	}
+	if err := helper.StartSession(foundUser.User_id, familyId, refreshToken); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start a session"})
+	}
 	helper.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+	foundUser.Token = &token
+	foundUser.Refresh_Token = &refreshToken
 
 	return c.Status(fiber.StatusOK).JSON(foundUser)
 }
 
+func RefreshToken(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var body struct {
+		Refresh_token string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.Refresh_token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	claims, msg := helper.ValidateRefreshToken(body.Refresh_token)
+	if msg != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": msg})
+	}
+
+	var foundUser models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&foundUser)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+
+	role := models.RoleWaiter
+	if foundUser.Role != nil {
+		role = *foundUser.Role
+	}
+
+	token, refreshToken, err := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id, role, claims.Family_id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate tokens"})
+	}
+	verdict, err := helper.RotateSession(claims, body.Refresh_token, refreshToken)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not store tokens"})
+	}
+	switch verdict {
+	case helper.RefreshEnded:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "refresh token is no longer valid"})
+	case helper.RefreshReused:
+		// The token was already exchanged, so someone is replaying it. Sign
+		// the user out everywhere to lock them out.
+		if err := helper.RevokeUserSessions(foundUser.User_id); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke sessions"})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "refresh token reuse detected, please login again"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"token":         token,
+		"refresh_token": refreshToken,
+	})
+}
+
+func UpdateUserRole(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var body struct {
+		Role *string `json:"role" validate:"required,eq=ADMIN|eq=MANAGER|eq=WAITER|eq=CHEF|eq=CASHIER"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userId := c.Params("user_id")
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "role", Value: body.Role},
+			{Key: "updated_at", Value: time.Now()},
+		}}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User role update failed"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	// Tokens carry the role they were signed with, so sign the user out to
+	// make the new role take effect straight away.
+	if err := helper.RevokeUserSessions(userId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke sessions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
 func HashPassword(password string) string {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	if err != nil {
@@ -156,3 +279,38 @@ func VerifyPassword(userPassword string, providedPassword string) (bool, string)
 	}
 	return true, ""
 }
+
+func Logout(c *fiber.Ctx) error {
+	claims, ok := c.Locals("claims").(*helper.SignedDetails)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	if err := helper.RevokeToken(claims); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "logout failed"})
+	}
+
+	// Only this session ends; logins on other devices stay signed in.
+	if err := helper.EndSession(claims.Uid, claims.Family_id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "logout failed"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "logged out"})
+}
+
+func RevokeSessions(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	userId := c.Params("user_id")
+	count, err := userCollection.CountDocuments(ctx, bson.M{"user_id": userId})
+	if err != nil || count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := helper.RevokeUserSessions(userId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke sessions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "all sessions revoked"})
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/models"
+)
+
+// Migrations rewrite documents stored in an older shape and add the indexes
+// the handlers rely on. Each one only matches documents that still need it,
+// and creating an index that exists is a no-op, so running them on every
+// start is safe.
+func RunMigrations() {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	migrations := []struct {
+		name string
+		run  func(context.Context) (int64, error)
+	}{
+		{"order item quantities", migrateOrderItemQuantities},
+		{"food prices to money", migrateFoodPrices},
+		{"order item prices to money", migrateOrderItemPrices},
+		{"unique coupon codes", indexCouponCodes},
+	}
+
+	for _, migration := range migrations {
+		count, err := migration.run(ctx)
+		if err != nil {
+			log.Fatalf("migration %q failed: %v", migration.name, err)
+		}
+		if count > 0 {
+			log.Printf("migration %q updated %d documents", migration.name, count)
+		}
+	}
+}
+
+// Order items used to keep the size (S/M/L) in quantity. Move it to size
+// and count the line as a single unit.
+func migrateOrderItemQuantities(ctx context.Context) (int64, error) {
+	orderItems := OpenCollection(Client, "orderItem")
+	result, err := orderItems.UpdateMany(
+		ctx,
+		bson.M{"quantity": bson.M{"$type": "string"}},
+		mongo.Pipeline{bson.D{{Key: "$set", Value: bson.D{
+			{Key: "size", Value: "$quantity"},
+			{Key: "quantity", Value: 1},
+		}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// Prices used to be doubles in major units. Rewrite them as money documents
+// in the default currency.
+func migrateFoodPrices(ctx context.Context) (int64, error) {
+	foods := OpenCollection(Client, "food")
+
+	result, err := foods.UpdateMany(
+		ctx,
+		bson.M{"price": bson.M{"$type": "number"}},
+		mongo.Pipeline{bson.D{{Key: "$set", Value: bson.D{
+			{Key: "price", Value: moneyExpression("$price")},
+		}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	modified := result.ModifiedCount
+
+	result, err = foods.UpdateMany(
+		ctx,
+		bson.M{"size_prices.price": bson.M{"$type": "number"}},
+		mongo.Pipeline{bson.D{{Key: "$set", Value: bson.D{
+			{Key: "size_prices", Value: bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: "$size_prices"},
+				{Key: "as", Value: "sizePrice"},
+				{Key: "in", Value: bson.D{
+					{Key: "size", Value: "$$sizePrice.size"},
+					{Key: "price", Value: bson.D{{Key: "$cond", Value: bson.A{
+						bson.D{{Key: "$isNumber", Value: "$$sizePrice.price"}},
+						moneyExpression("$$sizePrice.price"),
+						"$$sizePrice.price",
+					}}}},
+				}},
+			}}}},
+		}}}},
+	)
+	if err != nil {
+		return modified, err
+	}
+	return modified + result.ModifiedCount, nil
+}
+
+func migrateOrderItemPrices(ctx context.Context) (int64, error) {
+	orderItems := OpenCollection(Client, "orderItem")
+	result, err := orderItems.UpdateMany(
+		ctx,
+		bson.M{"unit_price": bson.M{"$type": "number"}},
+		mongo.Pipeline{bson.D{{Key: "$set", Value: bson.D{
+			{Key: "unit_price", Value: moneyExpression("$unit_price")},
+		}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// Two promotions must not share a coupon code, even when they are created at
+// the same moment. Promotions without a code are left out of the index.
+func indexCouponCodes(ctx context.Context) (int64, error) {
+	promotions := OpenCollection(Client, "promotion")
+	_, err := promotions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "coupon_code", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"coupon_code": bson.M{"$type": "string"}}),
+	})
+	return 0, err
+}
+
+func moneyExpression(field string) bson.D {
+	currency := models.DefaultCurrency()
+	scale := math.Pow10(models.CurrencyExponent(currency))
+	return bson.D{
+		{Key: "amount", Value: bson.D{{Key: "$toLong", Value: bson.D{{Key: "$round", Value: bson.A{
+			bson.D{{Key: "$multiply", Value: bson.A{field, scale}}}, 0,
+		}}}}}},
+		{Key: "currency", Value: currency},
+	}
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"sync"
+)
+
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Hub fans events out to in-process subscribers by topic. It keeps no history,
+// so a subscriber that falls behind is dropped and expected to resubscribe.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+const subscriberBuffer = 64
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[chan Event]struct{})}
+}
+
+var defaultHub = NewHub()
+
+func Subscribe(topic string) (<-chan Event, func()) {
+	return defaultHub.Subscribe(topic)
+}
+
+func Publish(topic string, event Event) {
+	defaultHub.Publish(topic, event)
+}
+
+func (h *Hub) Subscribe(topic string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = make(map[chan Event]struct{})
+	}
+	h.subscribers[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() { h.remove(topic, ch) })
+	}
+	return ch, unsubscribe
+}
+
+func (h *Hub) Publish(topic string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[topic] {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers[topic], ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *Hub) remove(topic string, ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[topic][ch]; ok {
+		delete(h.subscribers[topic], ch)
+		close(ch)
+	}
+}
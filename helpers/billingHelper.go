@@ -0,0 +1,335 @@
+package helper
+
+import (
+	"strings"
+
+	"golang-restaurant-management/models"
+)
+
+type BillLine struct {
+	Order_item_id string       `json:"order_item_id"`
+	Food_id       string       `json:"food_id"`
+	Food_name     string       `json:"food_name"`
+	Category      string       `json:"category"`
+	Size          *string      `json:"size"`
+	Quantity      int64        `json:"quantity"`
+	Unit_price    models.Money `json:"unit_price"`
+	Amount        models.Money `json:"amount"`
+	Discount      models.Money `json:"discount"`
+	Tax           models.Money `json:"tax"`
+}
+
+type DiscountLine struct {
+	Discount_id string       `json:"discount_id"`
+	Name        string       `json:"name"`
+	Amount      models.Money `json:"amount"`
+}
+
+type TaxLine struct {
+	Tax_id         string       `json:"tax_id"`
+	Tax_rule_id    string       `json:"tax_rule_id"`
+	Version        int          `json:"version"`
+	Name           string       `json:"name"`
+	Rate_bps       int          `json:"rate_bps"`
+	Inclusive      bool         `json:"inclusive"`
+	Taxable_amount models.Money `json:"taxable_amount"`
+	Amount         models.Money `json:"amount"`
+}
+
+type ServiceChargeLine struct {
+	Service_charge_id string       `json:"service_charge_id"`
+	Name              string       `json:"name"`
+	Rate_bps          int          `json:"rate_bps"`
+	Base              models.Money `json:"base"`
+	Amount            models.Money `json:"amount"`
+}
+
+type Bill struct {
+	Lines                []BillLine          `json:"lines"`
+	Subtotal             models.Money        `json:"subtotal"`
+	Discount_lines       []DiscountLine      `json:"discount_lines"`
+	Discount_total       models.Money        `json:"discount_total"`
+	Tax_lines            []TaxLine           `json:"tax_lines"`
+	Tax_total            models.Money        `json:"tax_total"`
+	Service_charges      []ServiceChargeLine `json:"service_charges"`
+	Service_charge_total models.Money        `json:"service_charge_total"`
+	Grand_total          models.Money        `json:"grand_total"`
+}
+
+// BuildBill prices the lines, takes the discounts off in the order they were
+// applied and taxes what is left. Inclusive taxes are already part of the line
+// amount and only reported; exclusive taxes are charged on top of the net and
+// recorded on each line, so a line's charge is its amount less its discount
+// plus its tax.
+func BuildBill(lines []BillLine, discounts []models.InvoiceDiscount, rules []models.TaxRule) Bill {
+	zero := models.NewMoney(0)
+	bill := Bill{
+		Lines:                lines,
+		Subtotal:             zero,
+		Discount_lines:       []DiscountLine{},
+		Discount_total:       zero,
+		Tax_lines:            []TaxLine{},
+		Tax_total:            zero,
+		Service_charges:      []ServiceChargeLine{},
+		Service_charge_total: zero,
+		Grand_total:          zero,
+	}
+
+	for i := range lines {
+		lines[i].Discount = zero
+		lines[i].Tax = zero
+	}
+	for _, discount := range discounts {
+		amount := applyDiscount(lines, discount)
+		bill.Discount_lines = append(bill.Discount_lines, DiscountLine{
+			Discount_id: discount.Discount_id,
+			Name:        discount.Name,
+			Amount:      amount,
+		})
+		bill.Discount_total = bill.Discount_total.Add(amount)
+	}
+
+	taxLines := make([]TaxLine, len(rules))
+	for i, rule := range rules {
+		taxLines[i] = TaxLine{
+			Tax_id:         rule.Tax_id,
+			Tax_rule_id:    rule.Tax_rule_id,
+			Version:        rule.Version,
+			Name:           *rule.Name,
+			Rate_bps:       *rule.Rate_bps,
+			Inclusive:      rule.Inclusive != nil && *rule.Inclusive,
+			Taxable_amount: zero,
+			Amount:         zero,
+		}
+	}
+
+	for li, line := range lines {
+		bill.Subtotal = bill.Subtotal.Add(line.Amount)
+
+		var applicable []int
+		inclusiveBps := int64(0)
+		for i, rule := range rules {
+			if !taxApplies(rule, line.Category) {
+				continue
+			}
+			applicable = append(applicable, i)
+			if taxLines[i].Inclusive {
+				inclusiveBps += int64(taxLines[i].Rate_bps)
+			}
+		}
+
+		net := DivRound((line.Amount.Amount-line.Discount.Amount)*10000, 10000+inclusiveBps)
+		for _, i := range applicable {
+			tax := DivRound(net*int64(taxLines[i].Rate_bps), 10000)
+			taxLines[i].Taxable_amount.Amount += net
+			taxLines[i].Amount.Amount += tax
+			if !taxLines[i].Inclusive {
+				lines[li].Tax.Amount += tax
+			}
+		}
+	}
+
+	exclusive := zero
+	for _, taxLine := range taxLines {
+		if taxLine.Taxable_amount.Amount == 0 {
+			continue
+		}
+		bill.Tax_lines = append(bill.Tax_lines, taxLine)
+		bill.Tax_total = bill.Tax_total.Add(taxLine.Amount)
+		if !taxLine.Inclusive {
+			exclusive = exclusive.Add(taxLine.Amount)
+		}
+	}
+
+	bill.Grand_total = bill.Subtotal.Sub(bill.Discount_total).Add(exclusive)
+	return bill
+}
+
+// AddServiceCharge charges the rule's rate on what the guest owes for the
+// items after discounts. The charge is not taxed and is added to the total.
+func AddServiceCharge(bill Bill, charge *models.InvoiceServiceCharge) Bill {
+	if charge == nil {
+		return bill
+	}
+
+	base := bill.Subtotal.Sub(bill.Discount_total)
+	line := ServiceChargeLine{
+		Service_charge_id: charge.Service_charge_id,
+		Name:              charge.Name,
+		Rate_bps:          charge.Rate_bps,
+		Base:              base,
+		Amount:            models.Money{Amount: DivRound(base.Amount*int64(charge.Rate_bps), 10000), Currency: base.Currency},
+	}
+
+	bill.Service_charges = append(bill.Service_charges, line)
+	bill.Service_charge_total = bill.Service_charge_total.Add(line.Amount)
+	bill.Grand_total = bill.Grand_total.Add(line.Amount)
+	return bill
+}
+
+// ShareBill returns part (counted from 1) of a bill split evenly in of ways.
+// Every figure is shared separately, and the cents that do not divide evenly
+// go to the last part, so the parts of each figure add up to the whole. The
+// part's grand total is worked out from its own shares so it matches them.
+func ShareBill(bill Bill, part, of int) Bill {
+	share := func(money models.Money) models.Money {
+		return models.Money{Amount: ShareAmount(money.Amount, part, of), Currency: money.Currency}
+	}
+
+	shared := bill
+	shared.Subtotal = share(bill.Subtotal)
+	shared.Discount_total = share(bill.Discount_total)
+	shared.Tax_total = share(bill.Tax_total)
+	shared.Service_charge_total = share(bill.Service_charge_total)
+
+	shared.Discount_lines = make([]DiscountLine, len(bill.Discount_lines))
+	for i, line := range bill.Discount_lines {
+		line.Amount = share(line.Amount)
+		shared.Discount_lines[i] = line
+	}
+	exclusive := models.Money{Currency: bill.Grand_total.Currency}
+	shared.Tax_lines = make([]TaxLine, len(bill.Tax_lines))
+	for i, line := range bill.Tax_lines {
+		line.Taxable_amount = share(line.Taxable_amount)
+		line.Amount = share(line.Amount)
+		shared.Tax_lines[i] = line
+		if !line.Inclusive {
+			exclusive = exclusive.Add(line.Amount)
+		}
+	}
+	shared.Service_charges = make([]ServiceChargeLine, len(bill.Service_charges))
+	for i, line := range bill.Service_charges {
+		line.Base = share(line.Base)
+		line.Amount = share(line.Amount)
+		shared.Service_charges[i] = line
+	}
+
+	shared.Grand_total = shared.Subtotal.Sub(shared.Discount_total).Add(exclusive).Add(shared.Service_charge_total)
+	return shared
+}
+
+// ShareAmount is part (counted from 1) of amount split evenly in of ways. The
+// last part takes what does not divide evenly.
+func ShareAmount(amount int64, part, of int) int64 {
+	if of <= 0 || part < 1 || part > of {
+		return 0
+	}
+	share := amount / int64(of)
+	if part == of {
+		share = amount - share*int64(of-1)
+	}
+	return share
+}
+
+// Takes the discount off the lines it covers and returns how much it took.
+// A line is never discounted below zero.
+func applyDiscount(lines []BillLine, discount models.InvoiceDiscount) models.Money {
+	var matching []int
+	remaining := int64(0)
+	for i, line := range lines {
+		left := line.Amount.Amount - line.Discount.Amount
+		if left > 0 && discountCovers(discount, line) {
+			matching = append(matching, i)
+			remaining += left
+		}
+	}
+
+	total := models.NewMoney(0)
+	if remaining == 0 {
+		return total
+	}
+
+	switch discount.Discount_type {
+	case models.DiscountPercentage:
+		if discount.Percent_bps == nil {
+			return total
+		}
+		for _, i := range matching {
+			left := lines[i].Amount.Amount - lines[i].Discount.Amount
+			off := DivRound(left*int64(*discount.Percent_bps), 10000)
+			lines[i].Discount.Amount += off
+			total.Amount += off
+		}
+
+	case models.DiscountFixed:
+		if discount.Amount == nil {
+			return total
+		}
+		target := discount.Amount.Amount
+		if target > remaining {
+			target = remaining
+		}
+		// Spread the amount in proportion to each line, then hand out the
+		// cents lost to rounding down one at a time.
+		allocated := int64(0)
+		for _, i := range matching {
+			left := lines[i].Amount.Amount - lines[i].Discount.Amount
+			off := target * left / remaining
+			lines[i].Discount.Amount += off
+			allocated += off
+		}
+		for _, i := range matching {
+			if allocated == target {
+				break
+			}
+			if lines[i].Amount.Amount-lines[i].Discount.Amount > 0 {
+				lines[i].Discount.Amount++
+				allocated++
+			}
+		}
+		total.Amount = allocated
+	}
+	return total
+}
+
+func discountCovers(discount models.InvoiceDiscount, line BillLine) bool {
+	switch discount.Scope {
+	case models.ScopeItem:
+		for _, foodId := range discount.Food_ids {
+			if foodId == line.Food_id {
+				return true
+			}
+		}
+		return false
+	case models.ScopeCategory:
+		for _, category := range discount.Categories {
+			if strings.EqualFold(category, line.Category) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func taxApplies(rule models.TaxRule, category string) bool {
+	if len(rule.Categories) == 0 {
+		return true
+	}
+	for _, c := range rule.Categories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// DivRound divides and rounds half away from zero.
+func DivRound(numerator, denominator int64) int64 {
+	if denominator == 0 {
+		return 0
+	}
+	negative := (numerator < 0) != (denominator < 0)
+	if numerator < 0 {
+		numerator = -numerator
+	}
+	if denominator < 0 {
+		denominator = -denominator
+	}
+	quotient := (numerator + denominator/2) / denominator
+	if negative {
+		return -quotient
+	}
+	return quotient
+}
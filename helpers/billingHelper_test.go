@@ -0,0 +1,260 @@
+package helper
+
+import (
+	"testing"
+
+	"golang-restaurant-management/models"
+)
+
+func line(foodId, category string, amount int64) BillLine {
+	return BillLine{Food_id: foodId, Category: category, Quantity: 1, Unit_price: models.NewMoney(amount), Amount: models.NewMoney(amount)}
+}
+
+func taxRule(name string, bps int, inclusive bool, categories ...string) models.TaxRule {
+	return models.TaxRule{Tax_id: name, Name: &name, Rate_bps: &bps, Inclusive: &inclusive, Categories: categories}
+}
+
+func percentOff(bps int, scope string, targets ...string) models.InvoiceDiscount {
+	discount := models.InvoiceDiscount{Discount_type: models.DiscountPercentage, Percent_bps: &bps, Scope: scope}
+	return withTargets(discount, targets)
+}
+
+func amountOff(amount int64, scope string, targets ...string) models.InvoiceDiscount {
+	money := models.NewMoney(amount)
+	discount := models.InvoiceDiscount{Discount_type: models.DiscountFixed, Amount: &money, Scope: scope}
+	return withTargets(discount, targets)
+}
+
+func withTargets(discount models.InvoiceDiscount, targets []string) models.InvoiceDiscount {
+	switch discount.Scope {
+	case models.ScopeItem:
+		discount.Food_ids = targets
+	case models.ScopeCategory:
+		discount.Categories = targets
+	}
+	return discount
+}
+
+func checkBill(t *testing.T, bill Bill, discount, tax, grand int64, lineOff, lineTax []int64) {
+	t.Helper()
+	if bill.Discount_total.Amount != discount {
+		t.Errorf("Discount_total = %d, want %d", bill.Discount_total.Amount, discount)
+	}
+	if bill.Tax_total.Amount != tax {
+		t.Errorf("Tax_total = %d, want %d", bill.Tax_total.Amount, tax)
+	}
+	if bill.Grand_total.Amount != grand {
+		t.Errorf("Grand_total = %d, want %d", bill.Grand_total.Amount, grand)
+	}
+	for i, line := range bill.Lines {
+		if line.Discount.Amount != lineOff[i] {
+			t.Errorf("line %d Discount = %d, want %d", i, line.Discount.Amount, lineOff[i])
+		}
+		if line.Tax.Amount != lineTax[i] {
+			t.Errorf("line %d Tax = %d, want %d", i, line.Tax.Amount, lineTax[i])
+		}
+	}
+}
+
+func TestBuildBillTaxes(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []BillLine
+		rules   []models.TaxRule
+		tax     int64
+		grand   int64
+		lineTax []int64
+	}{
+		{
+			name:    "exclusive tax is charged on top",
+			lines:   []BillLine{line("f1", "Food", 1000), line("f2", "Drinks", 500)},
+			rules:   []models.TaxRule{taxRule("vat", 1000, false)},
+			tax:     150,
+			grand:   1650,
+			lineTax: []int64{100, 50},
+		},
+		{
+			name:    "inclusive tax is only reported",
+			lines:   []BillLine{line("f1", "Food", 1200)},
+			rules:   []models.TaxRule{taxRule("vat", 2000, true)},
+			tax:     200,
+			grand:   1200,
+			lineTax: []int64{0},
+		},
+		{
+			name:    "tax only applies to its categories",
+			lines:   []BillLine{line("f1", "Food", 1000), line("f2", "Drinks", 500)},
+			rules:   []models.TaxRule{taxRule("liquor", 2000, false, "drinks")},
+			tax:     100,
+			grand:   1600,
+			lineTax: []int64{0, 100},
+		},
+		{
+			name:    "inclusive and exclusive taxes together",
+			lines:   []BillLine{line("f1", "Food", 1100)},
+			rules:   []models.TaxRule{taxRule("vat", 1000, true), taxRule("city", 500, false)},
+			tax:     150,
+			grand:   1150,
+			lineTax: []int64{50},
+		},
+		{
+			name:    "no rules, no tax",
+			lines:   []BillLine{line("f1", "Food", 999)},
+			grand:   999,
+			lineTax: []int64{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bill := BuildBill(tt.lines, nil, tt.rules)
+			checkBill(t, bill, 0, tt.tax, tt.grand, make([]int64, len(tt.lines)), tt.lineTax)
+		})
+	}
+}
+
+func TestBuildBillDiscounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []BillLine
+		discounts []models.InvoiceDiscount
+		rules     []models.TaxRule
+		discount  int64
+		tax       int64
+		grand     int64
+		lineOff   []int64
+		lineTax   []int64
+	}{
+		{
+			name:      "percentage discount comes off before tax",
+			lines:     []BillLine{line("f1", "Food", 1000), line("f2", "Drinks", 500)},
+			discounts: []models.InvoiceDiscount{percentOff(1000, models.ScopeOrder)},
+			rules:     []models.TaxRule{taxRule("vat", 1000, false)},
+			discount:  150,
+			tax:       135,
+			grand:     1485,
+			lineOff:   []int64{100, 50},
+			lineTax:   []int64{90, 45},
+		},
+		{
+			name:      "fixed discount is spread in proportion with the rounded cents handed out",
+			lines:     []BillLine{line("f1", "Food", 333), line("f2", "Food", 333), line("f3", "Food", 334)},
+			discounts: []models.InvoiceDiscount{amountOff(100, models.ScopeOrder)},
+			discount:  100,
+			grand:     900,
+			lineOff:   []int64{34, 33, 33},
+			lineTax:   []int64{0, 0, 0},
+		},
+		{
+			name:      "fixed discount never takes a line below zero",
+			lines:     []BillLine{line("f1", "Food", 1000), line("f2", "Drinks", 500)},
+			discounts: []models.InvoiceDiscount{amountOff(2000, models.ScopeOrder)},
+			rules:     []models.TaxRule{taxRule("vat", 1000, false)},
+			discount:  1500,
+			grand:     0,
+			lineOff:   []int64{1000, 500},
+			lineTax:   []int64{0, 0},
+		},
+		{
+			name:      "category discount only covers its lines",
+			lines:     []BillLine{line("f1", "Food", 1000), line("f2", "Drinks", 500)},
+			discounts: []models.InvoiceDiscount{percentOff(5000, models.ScopeCategory, "Drinks")},
+			discount:  250,
+			grand:     1250,
+			lineOff:   []int64{0, 250},
+			lineTax:   []int64{0, 0},
+		},
+		{
+			name:      "item discount stacks after an order discount",
+			lines:     []BillLine{line("f1", "Food", 1000), line("f2", "Drinks", 500)},
+			discounts: []models.InvoiceDiscount{percentOff(1000, models.ScopeOrder), amountOff(200, models.ScopeItem, "f2")},
+			discount:  350,
+			grand:     1150,
+			lineOff:   []int64{100, 250},
+			lineTax:   []int64{0, 0},
+		},
+		{
+			name:      "item discount for a food not on the bill takes nothing",
+			lines:     []BillLine{line("f1", "Food", 1000)},
+			discounts: []models.InvoiceDiscount{amountOff(200, models.ScopeItem, "f9")},
+			grand:     1000,
+			lineOff:   []int64{0},
+			lineTax:   []int64{0},
+		},
+		{
+			name:      "inclusive tax is worked out on the discounted amount",
+			lines:     []BillLine{line("f1", "Food", 1200)},
+			discounts: []models.InvoiceDiscount{amountOff(120, models.ScopeOrder)},
+			rules:     []models.TaxRule{taxRule("vat", 2000, true)},
+			discount:  120,
+			tax:       180,
+			grand:     1080,
+			lineOff:   []int64{120},
+			lineTax:   []int64{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bill := BuildBill(tt.lines, tt.discounts, tt.rules)
+			checkBill(t, bill, tt.discount, tt.tax, tt.grand, tt.lineOff, tt.lineTax)
+		})
+	}
+}
+
+func TestShareBillPartsAddUp(t *testing.T) {
+	lines := []BillLine{line("f1", "Food", 1001), line("f2", "Drinks", 337)}
+	bill := BuildBill(lines, []models.InvoiceDiscount{percentOff(1500, models.ScopeOrder)}, []models.TaxRule{taxRule("vat", 825, false)})
+	bill = AddServiceCharge(bill, &models.InvoiceServiceCharge{Name: "service", Rate_bps: 1250})
+
+	for _, of := range []int{2, 3, 7} {
+		var subtotal, discount, tax, service, grand int64
+		for part := 1; part <= of; part++ {
+			shared := ShareBill(bill, part, of)
+			exclusive := int64(0)
+			for _, taxLine := range shared.Tax_lines {
+				if !taxLine.Inclusive {
+					exclusive += taxLine.Amount.Amount
+				}
+			}
+			if want := shared.Subtotal.Amount - shared.Discount_total.Amount + exclusive + shared.Service_charge_total.Amount; shared.Grand_total.Amount != want {
+				t.Errorf("part %d of %d: Grand_total = %d, its figures add up to %d", part, of, shared.Grand_total.Amount, want)
+			}
+			subtotal += shared.Subtotal.Amount
+			discount += shared.Discount_total.Amount
+			tax += shared.Tax_total.Amount
+			service += shared.Service_charge_total.Amount
+			grand += shared.Grand_total.Amount
+		}
+
+		if subtotal != bill.Subtotal.Amount || discount != bill.Discount_total.Amount || tax != bill.Tax_total.Amount ||
+			service != bill.Service_charge_total.Amount || grand != bill.Grand_total.Amount {
+			t.Errorf("%d parts add up to subtotal %d discount %d tax %d service %d grand %d, want %d %d %d %d %d", of,
+				subtotal, discount, tax, service, grand,
+				bill.Subtotal.Amount, bill.Discount_total.Amount, bill.Tax_total.Amount, bill.Service_charge_total.Amount, bill.Grand_total.Amount)
+		}
+	}
+}
+
+func TestShareAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		part, of int
+		want     int64
+	}{
+		{1000, 1, 3, 333},
+		{1000, 2, 3, 333},
+		{1000, 3, 3, 334},
+		{1001, 2, 2, 501},
+		{5, 1, 1, 5},
+		{1000, 0, 3, 0},
+		{1000, 4, 3, 0},
+		{1000, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := ShareAmount(tt.amount, tt.part, tt.of); got != tt.want {
+			t.Errorf("ShareAmount(%d, %d, %d) = %d, want %d", tt.amount, tt.part, tt.of, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"golang-restaurant-management/database"
+)
+
+// One document per user: every token issued before Revoked_before_ns is dead,
+// as is any token whose id is listed in Revoked_tokens. The watermark is kept
+// in nanoseconds so a login straight after a revocation is not caught by it.
+type tokenRevocation struct {
+	User_id           string         `bson:"user_id"`
+	Revoked_before_ns int64          `bson:"revoked_before_ns"`
+	Revoked_tokens    []revokedToken `bson:"revoked_tokens"`
+}
+
+type revokedToken struct {
+	Token_id   string `bson:"token_id"`
+	Expires_at int64  `bson:"expires_at"`
+}
+
+var revocationCollection *mongo.Collection = database.OpenCollection(database.Client, "tokenRevocation")
+
+func RevokeToken(claims *SignedDetails) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": claims.Uid}
+	opts := options.Update().SetUpsert(true)
+
+	// Expired entries can never validate again, so drop them while we are here.
+	_, err := revocationCollection.UpdateOne(ctx, filter, bson.D{
+		{Key: "$pull", Value: bson.M{"revoked_tokens": bson.M{"expires_at": bson.M{"$lt": time.Now().Unix()}}}},
+	}, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = revocationCollection.UpdateOne(ctx, filter, bson.D{
+		{Key: "$addToSet", Value: bson.M{"revoked_tokens": revokedToken{
+			Token_id:   claims.Id,
+			Expires_at: claims.ExpiresAt,
+		}}},
+	}, opts)
+	return err
+}
+
+func RevokeUserSessions(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := revocationCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId},
+		bson.D{{Key: "$set", Value: bson.M{"revoked_before_ns": time.Now().UnixNano()}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := endUserSessions(userId); err != nil {
+		return err
+	}
+	return clearUserTokens(userId)
+}
+
+func isTokenRevoked(claims *SignedDetails) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var revocation tokenRevocation
+	err := revocationCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&revocation)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return revokedBy(revocation, claims), nil
+}
+
+func revokedBy(revocation tokenRevocation, claims *SignedDetails) bool {
+	// Tokens signed before Issued_ns existed carry zero and are always older.
+	if claims.Issued_ns < revocation.Revoked_before_ns {
+		return true
+	}
+	for _, revoked := range revocation.Revoked_tokens {
+		if revoked.Token_id == claims.Id {
+			return true
+		}
+	}
+	return false
+}
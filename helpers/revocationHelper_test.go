@@ -0,0 +1,39 @@
+package helper
+
+import (
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestRevokedBy(t *testing.T) {
+	const revokedAt = int64(1_700_000_000_500_000_000)
+
+	token := func(id string, issuedNs int64) *SignedDetails {
+		return &SignedDetails{Uid: "u1", Issued_ns: issuedNs, StandardClaims: jwt.StandardClaims{Id: id}}
+	}
+	watermark := tokenRevocation{User_id: "u1", Revoked_before_ns: revokedAt}
+	listed := tokenRevocation{User_id: "u1", Revoked_tokens: []revokedToken{{Token_id: "t2"}}}
+
+	tests := []struct {
+		name       string
+		revocation tokenRevocation
+		claims     *SignedDetails
+		want       bool
+	}{
+		{"issued before the watermark", watermark, token("t1", revokedAt-1), true},
+		{"issued at the watermark survives", watermark, token("t1", revokedAt), false},
+		{"issued in the same second after revoking", watermark, token("t1", revokedAt+1), false},
+		{"issued before nanosecond claims existed", watermark, token("t1", 0), true},
+		{"nothing revoked", tokenRevocation{User_id: "u1"}, token("t1", revokedAt), false},
+		{"listed token", listed, token("t2", revokedAt), true},
+		{"another token of the same user", listed, token("t3", revokedAt), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := revokedBy(tt.revocation, tt.claims); got != tt.want {
+				t.Errorf("revokedBy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
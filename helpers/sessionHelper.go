@@ -0,0 +1,112 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"golang-restaurant-management/database"
+)
+
+// One document per login. Each session has its own refresh token family, so
+// signing in on a second device leaves the first one signed in, and only the
+// family a replayed token belongs to is checked for reuse.
+type tokenSession struct {
+	Family_id     string    `bson:"family_id"`
+	User_id       string    `bson:"user_id"`
+	Refresh_token string    `bson:"refresh_token"`
+	Created_at    time.Time `bson:"created_at"`
+	Updated_at    time.Time `bson:"updated_at"`
+}
+
+// How a presented refresh token stands against its session.
+const (
+	RefreshAccepted = "ACCEPTED"
+	RefreshReused   = "REUSED"
+	RefreshEnded    = "ENDED"
+)
+
+var sessionCollection *mongo.Collection = database.OpenCollection(database.Client, "tokenSession")
+
+func StartSession(userId, familyId, signedRefreshToken string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err := sessionCollection.InsertOne(ctx, tokenSession{
+		Family_id:     familyId,
+		User_id:       userId,
+		Refresh_token: signedRefreshToken,
+		Created_at:    now,
+		Updated_at:    now,
+	})
+	return err
+}
+
+// RotateSession swaps the session's refresh token for the new one if the
+// presented token is the session's current one. Otherwise it reports whether
+// the token was reused or its session has ended, and changes nothing.
+func RotateSession(claims *SignedDetails, presentedRefreshToken, signedRefreshToken string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{"family_id": claims.Family_id, "user_id": claims.Uid}
+	var session tokenSession
+	err := sessionCollection.FindOne(ctx, filter).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return RefreshEnded, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if verdict := classifyRefresh(&session, presentedRefreshToken); verdict != RefreshAccepted {
+		return verdict, nil
+	}
+
+	// Two exchanges of the same token can both get this far; only the first
+	// swap matches, and the second is a reuse.
+	filter["refresh_token"] = presentedRefreshToken
+	result, err := sessionCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "refresh_token", Value: signedRefreshToken},
+		{Key: "updated_at", Value: time.Now()},
+	}}})
+	if err != nil {
+		return "", err
+	}
+	if result.MatchedCount == 0 {
+		return RefreshReused, nil
+	}
+	return RefreshAccepted, nil
+}
+
+func EndSession(userId, familyId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := sessionCollection.DeleteOne(ctx, bson.M{"family_id": familyId, "user_id": userId})
+	return err
+}
+
+func endUserSessions(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := sessionCollection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+// A session that is gone was logged out or revoked. A token that is not the
+// session's current one has already been rotated away, so whoever presents it
+// is replaying it.
+func classifyRefresh(session *tokenSession, presentedRefreshToken string) string {
+	switch {
+	case session == nil:
+		return RefreshEnded
+	case session.Refresh_token != presentedRefreshToken:
+		return RefreshReused
+	default:
+		return RefreshAccepted
+	}
+}
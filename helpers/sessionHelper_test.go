@@ -0,0 +1,26 @@
+package helper
+
+import "testing"
+
+func TestClassifyRefresh(t *testing.T) {
+	session := &tokenSession{Family_id: "family-1", User_id: "u1", Refresh_token: "current"}
+
+	tests := []struct {
+		name      string
+		session   *tokenSession
+		presented string
+		want      string
+	}{
+		{"current token is accepted", session, "current", RefreshAccepted},
+		{"rotated away token is a reuse", session, "previous", RefreshReused},
+		{"empty token is a reuse", session, "", RefreshReused},
+		{"logged out session has ended", nil, "current", RefreshEnded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyRefresh(tt.session, tt.presented); got != tt.want {
+				t.Errorf("classifyRefresh = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"time"
 	jwt "github.com/dgrijalva/jwt-go"
 	"go.mongodb.org/mongo-driver/bson"
-	//"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -19,26 +19,54 @@ type SignedDetails struct {
 	First_name string
 	Last_name  string
 	Uid        string
+	Role       string
+	Token_type string
+	Family_id  string
+	Issued_ns  int64
 	jwt.StandardClaims
 }
 
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+)
+
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 var SECRET_KEY string = os.Getenv("SECRET_KEY")
 
-func GenerateAllTokens(email, firstName, lastName, uid string) (signedToken string, signedRefreshToken string, err error) {
+// Every login starts a new refresh token family; rotations keep the family so
+// a replayed refresh token can be traced back and the whole family revoked.
+func NewTokenFamily() string {
+	return primitive.NewObjectID().Hex()
+}
+
+func GenerateAllTokens(email, firstName, lastName, uid, role, familyId string) (signedToken string, signedRefreshToken string, err error) {
+	now := time.Now()
 	claims := &SignedDetails{
 		Email:      email,
 		First_name: firstName,
 		Last_name:  lastName,
 		Uid:        uid,
+		Role:       role,
+		Token_type: AccessTokenType,
+		Family_id:  familyId,
+		Issued_ns:  now.UnixNano(),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+			Id:        primitive.NewObjectID().Hex(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(24 * time.Hour).Unix(),
 		},
 	}
 
 	refreshClaims := &SignedDetails{
+		Uid:        uid,
+		Token_type: RefreshTokenType,
+		Family_id:  familyId,
+		Issued_ns:  now.UnixNano(),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(168 * time.Hour).Unix(),
+			Id:        primitive.NewObjectID().Hex(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(168 * time.Hour).Unix(),
 		},
 	}
 
@@ -83,7 +111,72 @@ func UpdateAllTokens(signedToken, signedRefreshToken, userId string) {
 	}
 }
 
+func clearUserTokens(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "token", Value: nil},
+			{Key: "refresh_token", Value: nil},
+			{Key: "updated_at", Value: time.Now()},
+		}}},
+	)
+	return err
+}
+
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
+	claims, msg = parseToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if claims.Token_type == RefreshTokenType {
+		msg = "refresh token cannot be used for authentication"
+		return nil, msg
+	}
+
+	return claims, ""
+}
+
+func ValidateRefreshToken(signedToken string) (claims *SignedDetails, msg string) {
+	claims, msg = parseToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if claims.Token_type != RefreshTokenType || claims.Uid == "" || claims.Family_id == "" {
+		msg = "invalid refresh token"
+		return nil, msg
+	}
+
+	return claims, ""
+}
+
+func parseToken(signedToken string) (claims *SignedDetails, msg string) {
+	claims, msg = verifyToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	revoked, err := isTokenRevoked(claims)
+	if err != nil {
+		msg = "could not verify token"
+		return nil, msg
+	}
+	if revoked {
+		msg = "token has been revoked"
+		return nil, msg
+	}
+
+	return claims, ""
+}
+
+// verifyToken checks the signature and expiry of a token without looking up
+// whether it was revoked.
+func verifyToken(signedToken string) (claims *SignedDetails, msg string) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
 		&SignedDetails{},
@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func withSecret(t *testing.T, secret string) {
+	t.Helper()
+	previous := SECRET_KEY
+	SECRET_KEY = secret
+	t.Cleanup(func() { SECRET_KEY = previous })
+}
+
+func TestGenerateAllTokens(t *testing.T) {
+	withSecret(t, "test-secret")
+
+	token, refreshToken, err := GenerateAllTokens("ann@example.com", "Ann", "Lee", "u1", "WAITER", "family-1")
+	if err != nil {
+		t.Fatalf("GenerateAllTokens returned error: %v", err)
+	}
+
+	access, msg := verifyToken(token)
+	if msg != "" {
+		t.Fatalf("access token did not verify: %s", msg)
+	}
+	refresh, msg := verifyToken(refreshToken)
+	if msg != "" {
+		t.Fatalf("refresh token did not verify: %s", msg)
+	}
+
+	tests := []struct {
+		name      string
+		claims    *SignedDetails
+		tokenType string
+		role      string
+		lifetime  time.Duration
+	}{
+		{"access", access, AccessTokenType, "WAITER", 24 * time.Hour},
+		{"refresh", refresh, RefreshTokenType, "", 168 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.claims.Token_type != tt.tokenType {
+				t.Errorf("Token_type = %q, want %q", tt.claims.Token_type, tt.tokenType)
+			}
+			if tt.claims.Uid != "u1" || tt.claims.Family_id != "family-1" || tt.claims.Role != tt.role {
+				t.Errorf("got uid %q family %q role %q", tt.claims.Uid, tt.claims.Family_id, tt.claims.Role)
+			}
+			if tt.claims.Issued_ns == 0 || tt.claims.Issued_ns/int64(time.Second) != tt.claims.IssuedAt {
+				t.Errorf("Issued_ns = %d does not match IssuedAt %d", tt.claims.Issued_ns, tt.claims.IssuedAt)
+			}
+			if got := time.Duration(tt.claims.ExpiresAt-tt.claims.IssuedAt) * time.Second; got != tt.lifetime {
+				t.Errorf("lifetime = %v, want %v", got, tt.lifetime)
+			}
+		})
+	}
+	if access.Id == "" || access.Id == refresh.Id {
+		t.Errorf("tokens need their own ids, got %q and %q", access.Id, refresh.Id)
+	}
+}
+
+func TestVerifyTokenRejects(t *testing.T) {
+	withSecret(t, "test-secret")
+
+	token, _, err := GenerateAllTokens("ann@example.com", "Ann", "Lee", "u1", "WAITER", "family-1")
+	if err != nil {
+		t.Fatalf("GenerateAllTokens returned error: %v", err)
+	}
+	foreign, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &SignedDetails{Uid: "u1"}).SignedString([]byte("other-secret"))
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &SignedDetails{
+		Uid:            "u1",
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	}).SignedString([]byte("test-secret"))
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"garbage", "not.a.token"},
+		{"signed with another secret", foreign},
+		{"expired", expired},
+		{"tampered payload", tampered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if claims, msg := verifyToken(tt.token); msg == "" || claims != nil {
+				t.Errorf("verifyToken accepted the token, claims %+v", claims)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"golang-restaurant-management/database"
 	"golang-restaurant-management/middleware"
+	"golang-restaurant-management/payments"
+	"golang-restaurant-management/printing"
 	"golang-restaurant-management/routes"
 	"golang-restaurant-management/metrics"
 	"golang-restaurant-management/controllers"
@@ -22,6 +24,16 @@ func main() {
 
 	app := fiber.New()
 	database.DBinstance()
+	database.RunMigrations()
+
+	if _, err := payments.Current(); err != nil {
+		log.Fatal(err)
+	}
+	printer, err := printing.Current()
+	if err != nil {
+		log.Fatal(err)
+	}
+	controller.StartPrintQueue(printer)
 
 	app.Use(logger.New())
 
@@ -29,6 +41,7 @@ func main() {
 	public := app.Group("/users")
 	public.Post("/signup", controller.SignUp)
 	public.Post("/login", controller.Login)
+	public.Post("/refresh", controller.RefreshToken)
 
 	// Register custom Prometheus metrics
 	metrics.RegisterCustomMetrics()
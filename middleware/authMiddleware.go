@@ -3,6 +3,7 @@ package middleware
 import (
 	//"fmt"
 	helper "golang-restaurant-management/helpers"
+	"golang-restaurant-management/models"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -27,7 +28,27 @@ func Authentication() fiber.Handler {
 		c.Locals("first_name", claims.First_name)
 		c.Locals("last_name", claims.Last_name)
 		c.Locals("uid", claims.Uid)
+		c.Locals("role", claims.Role)
+		c.Locals("claims", claims)
 
 		return c.Next()
 	}
 }
+
+// Authorization must run after Authentication. Admins pass every check.
+func Authorization(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if role == models.RoleAdmin {
+			return c.Next()
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You are not allowed to perform this action",
+		})
+	}
+}
@@ -5,26 +5,452 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// A food is off sale while any ingredient in Low_stock_ingredients is below
+// its reorder level; inventory keeps the list up to date. The kitchen can
+// also take it off sale by clearing Available, or limit it to the portions
+// left in Remaining, which orders count down. A nil Remaining is no limit.
 type Food struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name       *string            `json:"name" validate:"required,min=2,max=100"`
-	Price      *float64           `json:"price" validate:"required"`
-	Food_image *string            `json:"food_image" validate:"required"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Food_id    string             `json:"food_id"`
-	Menu_id    *string            `json:"menu_id" validate:"required"`
+	ID                    primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name                  *string            `json:"name" validate:"required,min=2,max=100"`
+	Price                 *Money             `json:"price" validate:"required"`
+	Size_prices           []SizePrice        `json:"size_prices" validate:"omitempty,dive"`
+	Food_image            *string            `json:"food_image" validate:"required"`
+	Created_at            time.Time          `json:"created_at"`
+	Updated_at            time.Time          `json:"updated_at"`
+	Food_id               string             `json:"food_id"`
+	Menu_id               *string            `json:"menu_id" validate:"required"`
+	Station_id            *string            `json:"station_id"`
+	Recipe                []RecipeLine       `json:"recipe"`
+	Low_stock_ingredients []string           `json:"low_stock_ingredients"`
+	Modifier_groups       []ModifierGroup    `json:"modifier_groups" validate:"omitempty,dive"`
+	Bundle_slots          []BundleSlot       `json:"bundle_slots" validate:"omitempty,dive"`
+	Available             *bool              `json:"available"`
+	Remaining             *int               `json:"remaining" validate:"omitempty,min=0"`
+}
+
+// BundleSlot is one course of a set menu, such as the starter of a set
+// lunch. A food with bundle slots is sold as a bundle: the guest picks one
+// food from each slot and the bundle's price covers them all.
+type BundleSlot struct {
+	Slot_id  string   `json:"slot_id"`
+	Name     string   `json:"name" validate:"required,max=50"`
+	Food_ids []string `json:"food_ids" validate:"required,min=1"`
+}
+
+// RecipeLine is how much of an ingredient one portion of a food uses, in the
+// ingredient's unit.
+type RecipeLine struct {
+	Ingredient_id string  `json:"ingredient_id" validate:"required"`
+	Quantity      float64 `json:"quantity" validate:"gt=0"`
 }
 
+// ModifierGroup is a choice offered with a food, such as the doneness of a
+// steak or extra toppings. A required group needs at least one selection
+// even when Min_selections is 0; a Max_selections of 0 allows any number.
+type ModifierGroup struct {
+	Modifier_group_id string     `json:"modifier_group_id"`
+	Name              string     `json:"name" validate:"required,max=50"`
+	Required          bool       `json:"required"`
+	Min_selections    int        `json:"min_selections" validate:"min=0"`
+	Max_selections    int        `json:"max_selections" validate:"min=0"`
+	Options           []Modifier `json:"options" validate:"required,min=1,dive"`
+}
+
+// Modifier is one option in a group. Its price delta is added to the price
+// of each unit ordered with it and may be negative.
+type Modifier struct {
+	Modifier_id string `json:"modifier_id"`
+	Name        string `json:"name" validate:"required,max=50"`
+	Price_delta *Money `json:"price_delta"`
+}
+
+type SizePrice struct {
+	Size  string `json:"size" validate:"required,eq=S|eq=M|eq=L"`
+	Price *Money `json:"price" validate:"required"`
+}
+
+const (
+	PaymentPending       = "PENDING"
+	PaymentPartiallyPaid = "PARTIALLY_PAID"
+	PaymentPaid          = "PAID"
+
+	TenderCard = "CARD"
+	TenderCash = "CASH"
+
+	SplitEven  = "EVEN"
+	SplitItems = "ITEMS"
+	SplitSeats = "SEATS"
+)
+
+// An invoice bills the whole order unless it lists the order items it covers
+// or is one of several even shares of the order.
 type Invoice struct {
-	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Invoice_id       string             `json:"invoice_id"`
-	Order_id         string             `json:"order_id"`
-	Payment_method   *string            `json:"payment_method" validate:"eq=CARD|eq=CASH|eq="`
-	Payment_status   *string            `json:"payment_status" validate:"required,eq=PENDING|eq=PAID"`
-	Payment_due_date time.Time          `json:"payment_due_date"`
-	Created_at       time.Time          `json:"created_at"`
-	Updated_at       time.Time          `json:"updated_at"`
+	ID               primitive.ObjectID    `bson:"_id,omitempty" json:"id"`
+	Invoice_id       string                `json:"invoice_id"`
+	Order_id         string                `json:"order_id"`
+	Payment_method   *string               `json:"payment_method" validate:"eq=CARD|eq=CASH|eq="`
+	Payment_status   *string               `json:"payment_status" validate:"required,eq=PENDING|eq=PARTIALLY_PAID|eq=PAID"`
+	Payment_due_date time.Time             `json:"payment_due_date"`
+	Order_item_ids   []string              `json:"order_item_ids"`
+	Split_part       *int                  `json:"split_part"`
+	Split_of         *int                  `json:"split_of"`
+	Discounts        []InvoiceDiscount     `json:"discounts"`
+	Service_charge   *InvoiceServiceCharge `json:"service_charge"`
+	Payments         []Payment             `json:"payments"`
+	Failed_payments  []PaymentFailure      `json:"failed_payments"`
+	Created_at       time.Time             `json:"created_at"`
+	Updated_at       time.Time             `json:"updated_at"`
+}
+
+// Payment is one tender against an invoice. Amount is what it paid off; cash
+// handed over beyond the balance is returned as change. Refunded is how much
+// of it has been given back, counted before the money goes out.
+type Payment struct {
+	Payment_id     string    `json:"payment_id"`
+	Payment_method string    `json:"payment_method"`
+	Amount         Money     `json:"amount"`
+	Tendered       Money     `json:"tendered"`
+	Change         Money     `json:"change"`
+	Tip            Money     `json:"tip"`
+	Server_id      string    `json:"server_id"`
+	Provider       string    `json:"provider"`
+	Transaction_id string    `json:"transaction_id"`
+	Refunded       Money     `json:"refunded"`
+	Received_by    string    `json:"received_by"`
+	Received_at    time.Time `json:"received_at"`
+}
+
+// Refund gives money back on a paid invoice. It is kept as its own record so
+// the invoice and its payments stay as they were taken.
+type Refund struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Refund_id      string             `json:"refund_id"`
+	Invoice_id     string             `json:"invoice_id"`
+	Order_id       string             `json:"order_id"`
+	Payment_id     string             `json:"payment_id"`
+	Payment_method string             `json:"payment_method"`
+	Provider       string             `json:"provider"`
+	Transaction_id string             `json:"transaction_id"`
+	Lines          []RefundLine       `json:"lines"`
+	Amount         Money              `json:"amount"`
+	Reason         string             `json:"reason"`
+	Approved_by    string             `json:"approved_by"`
+	Created_at     time.Time          `json:"created_at"`
+}
+
+type RefundLine struct {
+	Order_item_id string `json:"order_item_id"`
+	Food_name     string `json:"food_name"`
+	Quantity      int64  `json:"quantity"`
+	Amount        Money  `json:"amount"`
+}
+
+// Void takes some or all of an order item off the bill before it is paid.
+type Void struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Void_id       string             `json:"void_id"`
+	Order_id      string             `json:"order_id"`
+	Order_item_id string             `json:"order_item_id"`
+	Food_id       string             `json:"food_id"`
+	Quantity      int                `json:"quantity"`
+	Amount        Money              `json:"amount"`
+	Reason        string             `json:"reason"`
+	Approved_by   string             `json:"approved_by"`
+	Created_at    time.Time          `json:"created_at"`
+}
+
+// PaymentFailure is a card payment the provider declined or could not take.
+type PaymentFailure struct {
+	Payment_method string    `json:"payment_method"`
+	Amount         Money     `json:"amount"`
+	Provider       string    `json:"provider"`
+	Transaction_id string    `json:"transaction_id"`
+	Failure_reason string    `json:"failure_reason"`
+	Attempted_by   string    `json:"attempted_by"`
+	Attempted_at   time.Time `json:"attempted_at"`
+}
+
+const (
+	DiscountPercentage = "PERCENTAGE"
+	DiscountFixed      = "FIXED"
+
+	ScopeOrder    = "ORDER"
+	ScopeItem     = "ITEM"
+	ScopeCategory = "CATEGORY"
+)
+
+type Promotion struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name          *string            `json:"name" validate:"required,min=2,max=100"`
+	Discount_type *string            `json:"discount_type" validate:"required,eq=PERCENTAGE|eq=FIXED"`
+	Percent_bps   *int               `json:"percent_bps" validate:"omitempty,min=1,max=10000"`
+	Amount        *Money             `json:"amount"`
+	Scope         *string            `json:"scope" validate:"required,eq=ORDER|eq=ITEM|eq=CATEGORY"`
+	Food_ids      []string           `json:"food_ids"`
+	Categories    []string           `json:"categories"`
+	Coupon_code   *string            `json:"coupon_code" validate:"omitempty,min=3,max=40,alphanum"`
+	Usage_limit   *int               `json:"usage_limit" validate:"omitempty,min=1"`
+	Times_used    int                `json:"times_used"`
+	Starts_at     *time.Time         `json:"starts_at"`
+	Expires_at    *time.Time         `json:"expires_at"`
+	Active        *bool              `json:"active"`
+	Created_at    time.Time          `json:"created_at"`
+	Updated_at    time.Time          `json:"updated_at"`
+	Promotion_id  string             `json:"promotion_id"`
+}
+
+// A service charge rule applies to orders at tables seating at least
+// Min_guests. When several apply, the one with the highest threshold wins.
+type ServiceChargeRule struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name              *string            `json:"name" validate:"required,min=2,max=100"`
+	Rate_bps          *int               `json:"rate_bps" validate:"required,min=1,max=10000"`
+	Min_guests        *int               `json:"min_guests" validate:"required,min=1"`
+	Active            *bool              `json:"active"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+	Service_charge_id string             `json:"service_charge_id"`
+}
+
+// InvoiceServiceCharge is the rule that applied when the invoice was created.
+type InvoiceServiceCharge struct {
+	Service_charge_id string `json:"service_charge_id"`
+	Name              string `json:"name"`
+	Rate_bps          int    `json:"rate_bps"`
+	Guests            int    `json:"guests"`
+}
+
+// InvoiceDiscount is a copy of the discount as it was applied, kept on the
+// invoice so later edits to the promotion do not rewrite past bills.
+type InvoiceDiscount struct {
+	Discount_id   string    `json:"discount_id"`
+	Promotion_id  *string   `json:"promotion_id"`
+	Coupon_code   *string   `json:"coupon_code"`
+	Name          string    `json:"name"`
+	Discount_type string    `json:"discount_type"`
+	Percent_bps   *int      `json:"percent_bps"`
+	Amount        *Money    `json:"amount"`
+	Scope         string    `json:"scope"`
+	Food_ids      []string  `json:"food_ids"`
+	Categories    []string  `json:"categories"`
+	Reason        *string   `json:"reason"`
+	Applied_by    string    `json:"applied_by"`
+	Approved_by   *string   `json:"approved_by"`
+	Applied_at    time.Time `json:"applied_at"`
+}
+
+// TaxRule versions are immutable: changing a tax closes the current version
+// and opens the next one, so an invoice can be taxed with the rules that were
+// in effect when it was created.
+type TaxRule struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Tax_id         string             `json:"tax_id"`
+	Version        int                `json:"version"`
+	Name           *string            `json:"name" validate:"required,min=2,max=100"`
+	Rate_bps       *int               `json:"rate_bps" validate:"required,min=0,max=10000"`
+	Inclusive      *bool              `json:"inclusive"`
+	Categories     []string           `json:"categories"`
+	Effective_from time.Time          `json:"effective_from"`
+	Effective_to   *time.Time         `json:"effective_to"`
+	Created_by     string             `json:"created_by"`
+	Created_at     time.Time          `json:"created_at"`
+	Tax_rule_id    string             `json:"tax_rule_id"`
+}
+
+// ReceiptTemplate is the restaurant's receipt layout. Header and footer lines
+// are printed centred above and below the bill.
+type ReceiptTemplate struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Template_id     string             `json:"template_id"`
+	Restaurant_name *string            `json:"restaurant_name" validate:"required,min=1,max=64"`
+	Header_lines    []string           `json:"header_lines" validate:"omitempty,max=10,dive,max=64"`
+	Footer_lines    []string           `json:"footer_lines" validate:"omitempty,max=10,dive,max=64"`
+	Tax_number      *string            `json:"tax_number" validate:"omitempty,max=64"`
+	Line_width      *int               `json:"line_width" validate:"omitempty,min=24,max=64"`
+	Show_sizes      *bool              `json:"show_sizes"`
+	Updated_by      string             `json:"updated_by"`
+	Updated_at      time.Time          `json:"updated_at"`
+}
+
+// Station is a prep station in the kitchen or bar with its own ticket
+// printer. Foods name the station that prepares them; foods without one go
+// to the default station.
+type Station struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Station_id      string             `json:"station_id"`
+	Name            *string            `json:"name" validate:"required,min=2,max=64"`
+	Printer_address *string            `json:"printer_address" validate:"omitempty,hostname_port"`
+	Default         *bool              `json:"default"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+}
+
+const (
+	PrintPending = "PENDING"
+	PrintPrinted = "PRINTED"
+	PrintFailed  = "FAILED"
+)
+
+// PrintJob is a rendered ticket waiting for, or sent to, a station's printer.
+// The printer address is looked up when the job is sent, so fixing a
+// station's printer lets its queued jobs through.
+type PrintJob struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Print_job_id    string             `json:"print_job_id"`
+	Station_id      string             `json:"station_id"`
+	Order_id        string             `json:"order_id"`
+	Order_item_ids  []string           `json:"order_item_ids"`
+	Data            []byte             `json:"-"`
+	Status          string             `json:"status"`
+	Attempts        int                `json:"attempts"`
+	Last_error      string             `json:"last_error"`
+	Next_attempt_at time.Time          `json:"next_attempt_at"`
+	Printed_at      *time.Time         `json:"printed_at"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+}
+
+// BusinessDay is a closed trading day and its Z-report. Sales count the
+// invoices opened in the day; payments, tips and refunds count the money
+// that moved in it, which is what the cash drawer holds.
+type BusinessDay struct {
+	ID                   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Business_day_id      string             `json:"business_day_id"`
+	Date                 string             `json:"date"`
+	From                 time.Time          `json:"from"`
+	To                   time.Time          `json:"to"`
+	Invoice_count        int64              `json:"invoice_count"`
+	Unpaid_invoice_count int64              `json:"unpaid_invoice_count"`
+	Subtotal             Money              `json:"subtotal"`
+	Discount_total       Money              `json:"discount_total"`
+	Service_charge_total Money              `json:"service_charge_total"`
+	Taxes                []TaxTotal         `json:"taxes"`
+	Tax_total            Money              `json:"tax_total"`
+	Grand_total          Money              `json:"grand_total"`
+	Payments             []TenderTotal      `json:"payments"`
+	Payment_total        Money              `json:"payment_total"`
+	Tip_total            Money              `json:"tip_total"`
+	Refunds              []TenderTotal      `json:"refunds"`
+	Refund_total         Money              `json:"refund_total"`
+	Opening_float        Money              `json:"opening_float"`
+	Expected_cash        Money              `json:"expected_cash"`
+	Counted_cash         *Money             `json:"counted_cash"`
+	Cash_variance        *Money             `json:"cash_variance"`
+	Notes                string             `json:"notes"`
+	Closed_by            string             `json:"closed_by"`
+	Closed_at            *time.Time         `json:"closed_at"`
+}
+
+type TaxTotal struct {
+	Name      string `json:"name"`
+	Inclusive bool   `json:"inclusive"`
+	Amount    Money  `json:"amount"`
+}
+
+// TenderTotal sums payments or refunds of one payment method. Tip is only
+// set for payments.
+type TenderTotal struct {
+	Payment_method string `json:"payment_method"`
+	Count          int64  `json:"count"`
+	Amount         Money  `json:"amount"`
+	Tip            Money  `json:"tip"`
+}
+
+// Ingredient is a stocked ingredient. Stock and the reorder level are in the
+// ingredient's unit; stock can go negative when more was sold than counted.
+// Hold_foods takes the foods that use the ingredient off sale while it is
+// below its reorder level.
+type Ingredient struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Ingredient_id string             `json:"ingredient_id"`
+	Name          *string            `json:"name" validate:"required,min=2,max=100"`
+	Unit          *string            `json:"unit" validate:"required,min=1,max=16"`
+	Stock         float64            `json:"stock"`
+	Reorder_level *float64           `json:"reorder_level" validate:"omitempty,min=0"`
+	Low_stock     bool               `json:"low_stock"`
+	Hold_foods    *bool              `json:"hold_foods"`
+	Created_at    time.Time          `json:"created_at"`
+	Updated_at    time.Time          `json:"updated_at"`
+}
+
+const (
+	StockOrdered    = "ORDERED"
+	StockCancelled  = "CANCELLED"
+	StockAdjustment = "ADJUSTMENT"
+	StockWaste      = "WASTE"
+	StockCount      = "COUNT"
+	StockReceived   = "RECEIVED"
+)
+
+// StockMovement is one change to an ingredient's stock, kept as a ledger.
+type StockMovement struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Stock_movement_id string             `json:"stock_movement_id"`
+	Ingredient_id     string             `json:"ingredient_id"`
+	Change            float64            `json:"change"`
+	Stock             float64            `json:"stock"`
+	Reason            string             `json:"reason"`
+	Order_id          string             `json:"order_id,omitempty"`
+	Order_item_id     string             `json:"order_item_id,omitempty"`
+	Purchase_order_id string             `json:"purchase_order_id,omitempty"`
+	Note              string             `json:"note,omitempty"`
+	Created_by        string             `json:"created_by"`
+	Created_at        time.Time          `json:"created_at"`
+}
+
+type Supplier struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Supplier_id    string             `json:"supplier_id"`
+	Name           *string            `json:"name" validate:"required,min=2,max=100"`
+	Contact_name   *string            `json:"contact_name" validate:"omitempty,max=100"`
+	Email          *string            `json:"email" validate:"omitempty,email"`
+	Phone          *string            `json:"phone" validate:"omitempty,max=32"`
+	Lead_time_days *int               `json:"lead_time_days" validate:"omitempty,min=0,max=60"`
+	Prices         []SupplierPrice    `json:"prices" validate:"omitempty,dive"`
+	Created_at     time.Time          `json:"created_at"`
+	Updated_at     time.Time          `json:"updated_at"`
+}
+
+// SupplierPrice is what a supplier charges per unit of an ingredient, in the
+// ingredient's unit. Pack_size, when set, is how many units come in the
+// smallest quantity they sell.
+type SupplierPrice struct {
+	Ingredient_id string   `json:"ingredient_id" validate:"required"`
+	Unit_price    *Money   `json:"unit_price" validate:"required"`
+	Pack_size     *float64 `json:"pack_size" validate:"omitempty,gt=0"`
+}
+
+const (
+	PurchaseDraft             = "DRAFT"
+	PurchaseSent              = "SENT"
+	PurchasePartiallyReceived = "PARTIALLY_RECEIVED"
+	PurchaseReceived          = "RECEIVED"
+	PurchaseCancelled         = "CANCELLED"
+)
+
+// PurchaseOrder is a restocking order to one supplier. It moves from DRAFT to
+// SENT, then to PARTIALLY_RECEIVED and RECEIVED as deliveries are booked in,
+// each adding to the ingredients' stock.
+type PurchaseOrder struct {
+	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Purchase_order_id string              `json:"purchase_order_id"`
+	Supplier_id       string              `json:"supplier_id" validate:"required"`
+	Status            string              `json:"status"`
+	Lines             []PurchaseOrderLine `json:"lines" validate:"required,min=1,dive"`
+	Total             Money               `json:"total"`
+	Notes             string              `json:"notes" validate:"max=500"`
+	Created_by        string              `json:"created_by"`
+	Sent_at           *time.Time          `json:"sent_at"`
+	Received_at       *time.Time          `json:"received_at"`
+	Created_at        time.Time           `json:"created_at"`
+	Updated_at        time.Time           `json:"updated_at"`
+}
+
+type PurchaseOrderLine struct {
+	Ingredient_id     string  `json:"ingredient_id" validate:"required"`
+	Quantity          float64 `json:"quantity" validate:"gt=0"`
+	Unit_price        *Money  `json:"unit_price"`
+	Received_quantity float64 `json:"received_quantity"`
 }
 
 type Menu struct {
@@ -33,11 +459,23 @@ type Menu struct {
 	Category   string             `json:"category" validate:"required"`
 	Start_Date *time.Time         `json:"start_date"`
 	End_Date   *time.Time         `json:"end_date"`
+	Dayparts   []Daypart          `json:"dayparts" validate:"omitempty,dive"`
 	Created_at time.Time          `json:"created_at"`
 	Updated_at time.Time          `json:"updated_at"`
 	Menu_id    string             `json:"menu_id"`
 }
 
+// Daypart is a recurring window a menu is served in, such as breakfast from
+// 07:00 to 11:00 or happy hour on weekdays from 17:00 to 19:00. Times are in
+// the restaurant's local time and a window ending before it starts runs past
+// midnight, counting as the day it started. No days means every day.
+type Daypart struct {
+	Name  string   `json:"name" validate:"max=50"`
+	Days  []string `json:"days" validate:"dive,eq=MON|eq=TUE|eq=WED|eq=THU|eq=FRI|eq=SAT|eq=SUN"`
+	Start string   `json:"start" validate:"required,datetime=15:04"`
+	End   string   `json:"end" validate:"required,datetime=15:04"`
+}
+
 type Note struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Text       string             `json:"text"`
@@ -47,26 +485,117 @@ type Note struct {
 	Note_id    string             `json:"note_id"`
 }
 
+const (
+	ItemQueued    = "QUEUED"
+	ItemStarted   = "STARTED"
+	ItemReady     = "READY"
+	ItemCancelled = "CANCELLED"
+	ItemVoided    = "VOIDED"
+)
+
 type OrderItem struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Quantity      *string            `json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
-	Unit_price    *float64           `json:"unit_price" validate:"required"`
-	Created_at    time.Time          `json:"created_at"`
-	Updated_at    time.Time          `json:"updated_at"`
-	Food_id       *string            `json:"food_id" validate:"required"`
-	Order_item_id string             `json:"order_item_id"`
-	Order_id      string             `json:"order_id" validate:"required"`
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Quantity        *int                `json:"quantity" validate:"required,min=1"`
+	Size            *string             `json:"size" validate:"omitempty,eq=S|eq=M|eq=L"`
+	Unit_price      *Money              `json:"unit_price"`
+	Seat            *int                `json:"seat" validate:"omitempty,min=1"`
+	Created_at      time.Time           `json:"created_at"`
+	Updated_at      time.Time           `json:"updated_at"`
+	Food_id         *string             `json:"food_id" validate:"required"`
+	Order_item_id   string              `json:"order_item_id"`
+	Order_id        string              `json:"order_id" validate:"required"`
+	Item_status     *string             `json:"item_status" validate:"omitempty,eq=QUEUED|eq=STARTED|eq=READY|eq=CANCELLED|eq=VOIDED"`
+	Voided_quantity int                 `json:"voided_quantity"`
+	Started_at      *time.Time          `json:"started_at"`
+	Ready_at        *time.Time          `json:"ready_at"`
+	Modifiers       []OrderItemModifier `json:"modifiers" validate:"dive"`
+	Notes           *string             `json:"notes" validate:"omitempty,max=200"`
+	Bundle_choices  []BundleChoice      `json:"bundle_choices" validate:"dive"`
+	Bundle_item_id  *string             `json:"bundle_item_id"`
+}
+
+// BundleChoice is the food picked for one slot of a bundle. A bundle's order
+// item is billed but never cooked; each choice becomes an order item of its
+// own for the kitchen, linked back through Bundle_item_id and billed at no
+// charge, while the price deltas of its modifiers go on the bundle. The
+// bundle item is created READY so the kitchen does not wait on it.
+type BundleChoice struct {
+	Slot_id       string              `json:"slot_id" validate:"required"`
+	Food_id       string              `json:"food_id" validate:"required"`
+	Modifiers     []OrderItemModifier `json:"modifiers" validate:"dive"`
+	Notes         *string             `json:"notes" validate:"omitempty,max=200"`
+	Order_item_id string              `json:"order_item_id"`
+}
+
+// OrderItemModifier is a modifier chosen for an order item, with the name and
+// price delta it had when ordered. The deltas are already part of the item's
+// Unit_price.
+type OrderItemModifier struct {
+	Modifier_group_id string `json:"modifier_group_id" validate:"required"`
+	Modifier_id       string `json:"modifier_id" validate:"required"`
+	Name              string `json:"name"`
+	Price_delta       Money  `json:"price_delta"`
+}
+
+const (
+	OrderPlaced    = "PLACED"
+	OrderInKitchen = "IN_KITCHEN"
+	OrderReady     = "READY"
+	OrderServed    = "SERVED"
+	OrderPaid      = "PAID"
+	OrderCancelled = "CANCELLED"
+)
+
+type OrderStatusChange struct {
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Changed_by string    `json:"changed_by"`
+	Changed_at time.Time `json:"changed_at"`
 }
 
 type Order struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Order_Date time.Time          `json:"order_date" validate:"required"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Order_id   string             `json:"order_id"`
-	Table_id   *string            `json:"table_id" validate:"required"`
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Order_Date     time.Time           `json:"order_date" validate:"required"`
+	Created_at     time.Time           `json:"created_at"`
+	Updated_at     time.Time           `json:"updated_at"`
+	Order_id       string              `json:"order_id"`
+	Table_id       *string             `json:"table_id" validate:"required"`
+	Server_id      *string             `json:"server_id"`
+	Order_status   *string             `json:"order_status"`
+	Status_history []OrderStatusChange `json:"status_history"`
+}
+
+const (
+	ReservationBooked    = "BOOKED"
+	ReservationSeated    = "SEATED"
+	ReservationCancelled = "CANCELLED"
+	ReservationNoShow    = "NO_SHOW"
+)
+
+type Reservation struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Guest_name       *string            `json:"guest_name" validate:"required,min=2,max=100"`
+	Phone            *string            `json:"phone" validate:"required"`
+	Party_size       *int               `json:"party_size" validate:"required,min=1"`
+	Start_time       *time.Time         `json:"start_time" validate:"required"`
+	Duration_minutes *int               `json:"duration_minutes" validate:"omitempty,min=15,max=480"`
+	End_time         time.Time          `json:"end_time"`
+	Table_id         *string            `json:"table_id"`
+	Status           string             `json:"status"`
+	Order_id         *string            `json:"order_id"`
+	Seated_at        *time.Time         `json:"seated_at"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Reservation_id   string             `json:"reservation_id"`
 }
 
+const (
+	TableFree     = "FREE"
+	TableOccupied = "OCCUPIED"
+	TableReserved = "RESERVED"
+	TableCleaning = "CLEANING"
+)
+
 type Table struct {
 	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Number_of_guests *int               `json:"number_of_guests" validate:"required"`
@@ -74,8 +603,19 @@ type Table struct {
 	Created_at       time.Time          `json:"created_at"`
 	Updated_at       time.Time          `json:"updated_at"`
 	Table_id         string             `json:"table_id"`
+	Table_status     *string            `json:"table_status"`
+	Current_order_id *string            `json:"current_order_id"`
+	Seated_at        *time.Time         `json:"seated_at"`
 }
 
+const (
+	RoleAdmin   = "ADMIN"
+	RoleManager = "MANAGER"
+	RoleWaiter  = "WAITER"
+	RoleChef    = "CHEF"
+	RoleCashier = "CASHIER"
+)
+
 type User struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	First_name    *string            `json:"first_name" validate:"required,min=2,max=100"`
@@ -84,6 +624,7 @@ type User struct {
 	Email         *string            `json:"email" validate:"email,required"`
 	Avatar        *string            `json:"avatar"`
 	Phone         *string            `json:"phone" validate:"required"`
+	Role          *string            `json:"role" validate:"omitempty,eq=ADMIN|eq=MANAGER|eq=WAITER|eq=CHEF|eq=CASHIER"`
 	Token         *string            `json:"token"`
 	Refresh_Token *string            `json:"refresh_token"`
 	Created_at    time.Time          `json:"created_at"`
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Money is an amount in the currency's minor unit (cents for USD) so sums and
+// products stay exact. It is stored and returned as {"amount", "currency"}.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// Minor unit exponents for currencies that do not use two decimal places.
+var currencyExponents = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"ISK": 0,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"VND": 0,
+}
+
+func DefaultCurrency() string {
+	if currency := os.Getenv("CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+func NewMoney(amount int64) Money {
+	return Money{Amount: amount, Currency: DefaultCurrency()}
+}
+
+// Converts an amount in major units, rounding half away from zero.
+func MoneyFromFloat(value float64, currency string) Money {
+	scale := math.Pow(10, float64(CurrencyExponent(currency)))
+	return Money{Amount: int64(math.Round(value * scale)), Currency: currency}
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currencyOr(other)}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currencyOr(other)}
+}
+
+func (m Money) Times(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+func (m Money) currencyOr(other Money) string {
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return other.Currency
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Decimal formats the amount in major units without the currency code.
+func (m Money) Decimal() string {
+	exponent := CurrencyExponent(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exponent == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	scale := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, exponent, amount%scale)
+}
+
+// UnmarshalJSON accepts the {"amount", "currency"} object as well as the
+// decimal prices older clients send, either as a number or a string, which
+// are read in major units of the default currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		type plain Money
+		var decoded plain
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return err
+		}
+		*m = Money(decoded)
+		if m.Currency == "" {
+			m.Currency = DefaultCurrency()
+		}
+		m.Currency = strings.ToUpper(m.Currency)
+		return nil
+	}
+
+	decimal := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &decimal); err != nil {
+			return err
+		}
+	}
+
+	currency := DefaultCurrency()
+	amount, err := parseDecimal(decimal, CurrencyExponent(currency))
+	if err != nil {
+		return fmt.Errorf("invalid price %s: %w", decimal, err)
+	}
+	*m = Money{Amount: amount, Currency: currency}
+	return nil
+}
+
+// UnmarshalBSONValue also reads prices stored as plain doubles before money
+// had its own type, in case a document was written after the migration ran.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	currency := DefaultCurrency()
+
+	switch t {
+	case bsontype.Double:
+		*m = MoneyFromFloat(raw.Double(), currency)
+	case bsontype.Int32:
+		*m = MoneyFromFloat(float64(raw.Int32()), currency)
+	case bsontype.Int64:
+		*m = MoneyFromFloat(float64(raw.Int64()), currency)
+	case bsontype.EmbeddedDocument:
+		type plain Money
+		var decoded plain
+		if err := raw.Unmarshal(&decoded); err != nil {
+			return err
+		}
+		*m = Money(decoded)
+	case bsontype.Null:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode %s into Money", t)
+	}
+	return nil
+}
+
+// Parses a decimal string into minor units without going through float64.
+func parseDecimal(value string, exponent int) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("empty amount")
+	}
+
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	for _, part := range []string{whole, fraction} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, errors.New("not a decimal number")
+			}
+		}
+	}
+
+	roundUp := false
+	if len(fraction) > exponent {
+		roundUp = fraction[exponent] >= '5'
+		fraction = fraction[:exponent]
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if roundUp {
+		amount++
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
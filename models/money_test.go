@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		value    string
+		exponent int
+		want     int64
+		wantErr  bool
+	}{
+		{"12.34", 2, 1234, false},
+		{"12", 2, 1200, false},
+		{"12.3", 2, 1230, false},
+		{".5", 2, 50, false},
+		{" 4.20 ", 2, 420, false},
+		{"+3.10", 2, 310, false},
+		{"0.005", 2, 1, false},
+		{"0.0049", 2, 0, false},
+		{"1.999", 2, 200, false},
+		{"-1.235", 2, -124, false},
+		{"-0.004", 2, 0, false},
+		{"12.5", 0, 13, false},
+		{"1.2345", 3, 1235, false},
+		{"", 2, 0, true},
+		{"abc", 2, 0, true},
+		{"1.2.3", 2, 0, true},
+		{"1e3", 2, 0, true},
+		{"--1", 2, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDecimal(tt.value, tt.exponent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDecimal(%q, %d) error = %v, wantErr %v", tt.value, tt.exponent, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseDecimal(%q, %d) = %d, want %d", tt.value, tt.exponent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	t.Setenv("CURRENCY", "")
+
+	tests := []struct {
+		data    string
+		want    Money
+		wantErr bool
+	}{
+		{`{"amount": 250, "currency": "eur"}`, Money{Amount: 250, Currency: "EUR"}, false},
+		{`{"amount": 250}`, Money{Amount: 250, Currency: "USD"}, false},
+		{`12.5`, Money{Amount: 1250, Currency: "USD"}, false},
+		{`"7.255"`, Money{Amount: 726, Currency: "USD"}, false},
+		{`"seven"`, Money{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		value    float64
+		currency string
+		want     int64
+	}{
+		{12.346, "USD", 1235},
+		{-0.125, "USD", -13},
+		{99.5, "JPY", 100},
+		{1.0006, "KWD", 1001},
+	}
+
+	for _, tt := range tests {
+		if got := MoneyFromFloat(tt.value, tt.currency); got.Amount != tt.want || got.Currency != tt.currency {
+			t.Errorf("MoneyFromFloat(%v, %s) = %+v, want %d %s", tt.value, tt.currency, got, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 1234, Currency: "USD"}, "12.34"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05"},
+		{Money{Amount: -1205, Currency: "USD"}, "-12.05"},
+		{Money{Amount: 1500, Currency: "JPY"}, "1500"},
+		{Money{Amount: 1001, Currency: "KWD"}, "1.001"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.want {
+			t.Errorf("%+v.Decimal() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
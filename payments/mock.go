@@ -0,0 +1,133 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang-restaurant-management/models"
+)
+
+// Card tokens the mock provider declines, and the reason it gives. Any other
+// token is approved.
+var mockDeclines = map[string]string{
+	"tok_declined":           "card_declined",
+	"tok_insufficient_funds": "insufficient_funds",
+	"tok_expired":            "expired_card",
+}
+
+// MockProvider is an in-process gateway for development and tests. Its
+// answers depend only on the card token and the calls made so far, and
+// transaction ids count up from mock_1 for the life of the process.
+type MockProvider struct {
+	mu           sync.Mutex
+	sequence     int
+	transactions map[string]*mockTransaction
+}
+
+type mockTransaction struct {
+	authorized models.Money
+	captured   models.Money
+	refunded   models.Money
+	voided     bool
+}
+
+func NewMockProvider() *MockProvider {
+	return &MockProvider{transactions: make(map[string]*mockTransaction)}
+}
+
+func init() {
+	Register(NewMockProvider())
+}
+
+func (m *MockProvider) Name() string {
+	return "mock"
+}
+
+func (m *MockProvider) Authorize(ctx context.Context, request AuthorizeRequest) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sequence++
+	result := Result{Transaction_id: fmt.Sprintf("mock_%d", m.sequence)}
+	if reason, declined := mockDeclines[request.Card_token]; declined {
+		result.Failure_reason = reason
+		return result, nil
+	}
+	if request.Card_token == "" {
+		result.Failure_reason = "missing_card_token"
+		return result, nil
+	}
+	if request.Amount.Amount <= 0 {
+		result.Failure_reason = "invalid_amount"
+		return result, nil
+	}
+
+	m.transactions[result.Transaction_id] = &mockTransaction{
+		authorized: request.Amount,
+		captured:   models.Money{Currency: request.Amount.Currency},
+		refunded:   models.Money{Currency: request.Amount.Currency},
+	}
+	result.Approved = true
+	return result, nil
+}
+
+func (m *MockProvider) Capture(ctx context.Context, transactionId string, amount models.Money) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := Result{Transaction_id: transactionId}
+	transaction, ok := m.transactions[transactionId]
+	switch {
+	case !ok:
+		result.Failure_reason = "unknown_transaction"
+	case transaction.voided:
+		result.Failure_reason = "authorization_voided"
+	case transaction.captured.Amount > 0:
+		result.Failure_reason = "already_captured"
+	case amount.Amount > transaction.authorized.Amount:
+		result.Failure_reason = "amount_exceeds_authorization"
+	default:
+		transaction.captured = amount
+		result.Approved = true
+	}
+	return result, nil
+}
+
+func (m *MockProvider) Void(ctx context.Context, transactionId string) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := Result{Transaction_id: transactionId}
+	transaction, ok := m.transactions[transactionId]
+	switch {
+	case !ok:
+		result.Failure_reason = "unknown_transaction"
+	case transaction.captured.Amount > 0:
+		result.Failure_reason = "already_captured"
+	default:
+		transaction.voided = true
+		result.Approved = true
+	}
+	return result, nil
+}
+
+func (m *MockProvider) Refund(ctx context.Context, transactionId string, amount models.Money) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := Result{Transaction_id: transactionId}
+	transaction, ok := m.transactions[transactionId]
+	switch {
+	case !ok:
+		result.Failure_reason = "unknown_transaction"
+	case amount.Amount <= 0:
+		result.Failure_reason = "invalid_amount"
+	case transaction.refunded.Amount+amount.Amount > transaction.captured.Amount:
+		result.Failure_reason = "amount_exceeds_capture"
+	default:
+		transaction.refunded = transaction.refunded.Add(amount)
+		result.Approved = true
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package payments
+
+import (
+	"context"
+	"testing"
+
+	"golang-restaurant-management/models"
+)
+
+func usd(amount int64) models.Money {
+	return models.Money{Amount: amount, Currency: "USD"}
+}
+
+func TestMockAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		amount int64
+		reason string
+	}{
+		{"approved", "tok_visa", 1500, ""},
+		{"declined", "tok_declined", 1500, "card_declined"},
+		{"insufficient funds", "tok_insufficient_funds", 1500, "insufficient_funds"},
+		{"expired", "tok_expired", 1500, "expired_card"},
+		{"missing token", "", 1500, "missing_card_token"},
+		{"zero amount", "tok_visa", 0, "invalid_amount"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewMockProvider()
+			result, err := provider.Authorize(context.Background(), AuthorizeRequest{Amount: usd(tt.amount), Card_token: tt.token})
+			if err != nil {
+				t.Fatalf("Authorize returned error: %v", err)
+			}
+			if result.Transaction_id != "mock_1" {
+				t.Errorf("Transaction_id = %q, want mock_1", result.Transaction_id)
+			}
+			if result.Approved != (tt.reason == "") || result.Failure_reason != tt.reason {
+				t.Errorf("got approved %v reason %q, want reason %q", result.Approved, result.Failure_reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestMockTransactionIdsCountUp(t *testing.T) {
+	provider := NewMockProvider()
+	ctx := context.Background()
+	for _, want := range []string{"mock_1", "mock_2", "mock_3"} {
+		result, _ := provider.Authorize(ctx, AuthorizeRequest{Amount: usd(100), Card_token: "tok_declined"})
+		if result.Transaction_id != want {
+			t.Errorf("Transaction_id = %q, want %q", result.Transaction_id, want)
+		}
+	}
+}
+
+func TestMockLifecycle(t *testing.T) {
+	type step struct {
+		op     string
+		amount int64
+		reason string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"capture then refund in parts", []step{
+			{"capture", 1000, ""},
+			{"refund", 400, ""},
+			{"refund", 600, ""},
+			{"refund", 1, "amount_exceeds_capture"},
+		}},
+		{"capture more than authorized", []step{
+			{"capture", 1001, "amount_exceeds_authorization"},
+		}},
+		{"capture twice", []step{
+			{"capture", 500, ""},
+			{"capture", 500, "already_captured"},
+		}},
+		{"void before capture", []step{
+			{"void", 0, ""},
+			{"capture", 1000, "authorization_voided"},
+		}},
+		{"void after capture", []step{
+			{"capture", 1000, ""},
+			{"void", 0, "already_captured"},
+		}},
+		{"refund before capture", []step{
+			{"refund", 100, "amount_exceeds_capture"},
+		}},
+		{"refund nothing", []step{
+			{"capture", 1000, ""},
+			{"refund", 0, "invalid_amount"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewMockProvider()
+			ctx := context.Background()
+			authorized, _ := provider.Authorize(ctx, AuthorizeRequest{Amount: usd(1000), Card_token: "tok_visa"})
+
+			for i, s := range tt.steps {
+				var result Result
+				var err error
+				switch s.op {
+				case "capture":
+					result, err = provider.Capture(ctx, authorized.Transaction_id, usd(s.amount))
+				case "void":
+					result, err = provider.Void(ctx, authorized.Transaction_id)
+				case "refund":
+					result, err = provider.Refund(ctx, authorized.Transaction_id, usd(s.amount))
+				}
+				if err != nil {
+					t.Fatalf("step %d %s returned error: %v", i, s.op, err)
+				}
+				if result.Approved != (s.reason == "") || result.Failure_reason != s.reason {
+					t.Errorf("step %d %s: got approved %v reason %q, want reason %q", i, s.op, result.Approved, result.Failure_reason, s.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestMockUnknownTransaction(t *testing.T) {
+	provider := NewMockProvider()
+	ctx := context.Background()
+
+	capture, _ := provider.Capture(ctx, "mock_9", usd(100))
+	void, _ := provider.Void(ctx, "mock_9")
+	refund, _ := provider.Refund(ctx, "mock_9", usd(100))
+	for name, result := range map[string]Result{"capture": capture, "void": void, "refund": refund} {
+		if result.Approved || result.Failure_reason != "unknown_transaction" {
+			t.Errorf("%s: got approved %v reason %q, want unknown_transaction", name, result.Approved, result.Failure_reason)
+		}
+	}
+}
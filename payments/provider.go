@@ -0,0 +1,69 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang-restaurant-management/models"
+)
+
+// Provider is a card payment gateway. A payment is authorized first and
+// captured once the sale is final; an authorization that will not be
+// captured is voided, and captured money is given back with a refund.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, request AuthorizeRequest) (Result, error)
+	Capture(ctx context.Context, transactionId string, amount models.Money) (Result, error)
+	Void(ctx context.Context, transactionId string) (Result, error)
+	Refund(ctx context.Context, transactionId string, amount models.Money) (Result, error)
+}
+
+type AuthorizeRequest struct {
+	Reference  string
+	Amount     models.Money
+	Card_token string
+}
+
+// Result is the gateway's answer. A declined operation is not an error: it
+// comes back with Approved false and the gateway's reason. Errors are kept
+// for failures to reach the gateway at all.
+type Result struct {
+	Transaction_id string
+	Approved       bool
+	Failure_reason string
+}
+
+const defaultProvider = "mock"
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+)
+
+// Register makes a provider available under its name so it can be selected
+// with the PAYMENT_PROVIDER environment variable.
+func Register(provider Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[provider.Name()] = provider
+}
+
+// Current returns the provider selected by PAYMENT_PROVIDER, or the mock
+// provider when it is not set.
+func Current() (Provider, error) {
+	name := strings.ToLower(os.Getenv("PAYMENT_PROVIDER"))
+	if name == "" {
+		name = defaultProvider
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("payment provider %q is not registered", name)
+	}
+	return provider, nil
+}
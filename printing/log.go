@@ -0,0 +1,22 @@
+package printing
+
+import (
+	"context"
+	"log"
+)
+
+// LogPrinter only logs tickets, for running without printers on the network.
+type LogPrinter struct{}
+
+func init() {
+	Register(LogPrinter{})
+}
+
+func (LogPrinter) Name() string {
+	return "log"
+}
+
+func (LogPrinter) Print(ctx context.Context, address string, data []byte) error {
+	log.Printf("print: %d bytes to %s", len(data), address)
+	return nil
+}
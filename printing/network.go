@@ -0,0 +1,40 @@
+package printing
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+const networkTimeout = 10 * time.Second
+
+// NetworkPrinter writes tickets to the raw printing port (usually 9100) that
+// networked thermal printers listen on.
+type NetworkPrinter struct{}
+
+func init() {
+	Register(NetworkPrinter{})
+}
+
+func (NetworkPrinter) Name() string {
+	return "network"
+}
+
+func (NetworkPrinter) Print(ctx context.Context, address string, data []byte) error {
+	dialer := net.Dialer{Timeout: networkTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(networkTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
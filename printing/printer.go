@@ -0,0 +1,49 @@
+package printing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Printer sends a rendered ticket to the printer at an address. Print only
+// returns once the printer has taken the whole ticket, so a nil error means
+// the job can be marked printed.
+type Printer interface {
+	Name() string
+	Print(ctx context.Context, address string, data []byte) error
+}
+
+const defaultPrinter = "network"
+
+var (
+	mu       sync.RWMutex
+	printers = map[string]Printer{}
+)
+
+// Register makes a printer available under its name so it can be selected
+// with the PRINTER_DRIVER environment variable.
+func Register(printer Printer) {
+	mu.Lock()
+	defer mu.Unlock()
+	printers[printer.Name()] = printer
+}
+
+// Current returns the printer selected by PRINTER_DRIVER, or the network
+// printer when it is not set.
+func Current() (Printer, error) {
+	name := strings.ToLower(os.Getenv("PRINTER_DRIVER"))
+	if name == "" {
+		name = defaultPrinter
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	printer, ok := printers[name]
+	if !ok {
+		return nil, fmt.Errorf("printer driver %q is not registered", name)
+	}
+	return printer, nil
+}
@@ -0,0 +1,68 @@
+package receipts
+
+import (
+	"bytes"
+)
+
+// ESC/POS commands understood by common thermal receipt printers.
+var (
+	escInit          = []byte{0x1b, 0x40}
+	escAlign         = []byte{0x1b, 0x61}
+	escBold          = []byte{0x1b, 0x45}
+	escSize          = []byte{0x1d, 0x21}
+	escFeed          = []byte{0x1b, 0x64}
+	escPartialCut    = []byte{0x1d, 0x56, 0x42, 0x00}
+	sizeNormal       = byte(0x00)
+	sizeDoubleHeight = byte(0x01)
+)
+
+// ESCPOS encodes the lines for a thermal printer, using the printer's own
+// alignment and emphasis, then feeds and cuts the paper. Printers only
+// handle single-byte code pages, so anything outside ASCII prints as '?'.
+func ESCPOS(lines []Line, width int) []byte {
+	var b bytes.Buffer
+	b.Write(escInit)
+
+	for _, line := range lines {
+		b.Write(escAlign)
+		b.WriteByte(byte(line.Align))
+		if line.Bold {
+			b.Write(escBold)
+			b.WriteByte(1)
+		}
+		if line.Large {
+			b.Write(escSize)
+			b.WriteByte(sizeDoubleHeight)
+		}
+
+		b.WriteString(ascii(truncate(line.Text, width)))
+		b.WriteByte('\n')
+
+		if line.Large {
+			b.Write(escSize)
+			b.WriteByte(sizeNormal)
+		}
+		if line.Bold {
+			b.Write(escBold)
+			b.WriteByte(0)
+		}
+	}
+
+	b.Write(escAlign)
+	b.WriteByte(AlignLeft)
+	b.Write(escFeed)
+	b.WriteByte(4)
+	b.Write(escPartialCut)
+	return b.Bytes()
+}
+
+func ascii(text string) string {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r < 0x20 || r > 0x7e {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return string(out)
+}
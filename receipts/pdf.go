@@ -0,0 +1,130 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDF page metrics, in points. Courier at 9pt is 5.4pt per character, which
+// puts a 42 character line on an 80mm roll with a small margin.
+const (
+	pdfFontSize   = 9.0
+	pdfCharWidth  = pdfFontSize * 0.6
+	pdfLeading    = 11.0
+	pdfLargeSize  = 13.0
+	pdfMargin     = 12.0
+	pdfLargeExtra = pdfLargeSize - pdfFontSize
+	pdfMaxLines   = 120
+)
+
+// PDF writes the lines as a receipt-shaped PDF in Courier, which every
+// reader ships, so no fonts need to be embedded. Pages are as tall as the
+// receipt, up to pdfMaxLines lines each.
+func PDF(lines []Line, width int) []byte {
+	pageWidth := pdfMargin*2 + pdfCharWidth*float64(width)
+
+	var pages [][]Line
+	for len(lines) > pdfMaxLines {
+		pages = append(pages, lines[:pdfMaxLines])
+		lines = lines[pdfMaxLines:]
+	}
+	pages = append(pages, lines)
+
+	// Objects 1 and 2 are the catalog and page tree, 3 and 4 the fonts, and
+	// each page takes two more: the page and its content stream.
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	var kids []string
+	for _, page := range pages {
+		pageHeight := pdfMargin * 2
+		for _, line := range page {
+			pageHeight += pdfLeading
+			if line.Large {
+				pageHeight += pdfLargeExtra
+			}
+		}
+		pageId := len(objects) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageId))
+
+		content := pdfContent(page, width, pageHeight)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, pageId+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func pdfContent(lines []Line, width int, pageHeight float64) string {
+	var b strings.Builder
+	b.WriteString("BT\n")
+	y := pageHeight - pdfMargin
+	for _, line := range lines {
+		y -= pdfFontSize
+		if line.Large {
+			y -= pdfLargeExtra
+		}
+		font, size := "/F1", pdfFontSize
+		if line.Bold {
+			font = "/F2"
+		}
+		text := pad(line, width)
+		if line.Large {
+			// Large text is wider, so centre it on its own measure.
+			size = pdfLargeSize
+			text = strings.TrimSpace(line.Text)
+			x := (pdfMargin*2 + pdfCharWidth*float64(width) - size*0.6*float64(len([]rune(text)))) / 2
+			if x < pdfMargin {
+				x = pdfMargin
+			}
+			fmt.Fprintf(&b, "%s %.1f Tf\n1 0 0 1 %.2f %.2f Tm\n(%s) Tj\n", font, size, x, y, pdfEscape(text))
+		} else {
+			fmt.Fprintf(&b, "%s %.1f Tf\n1 0 0 1 %.2f %.2f Tm\n(%s) Tj\n", font, size, pdfMargin, y, pdfEscape(text))
+		}
+		y -= pdfLeading - pdfFontSize
+	}
+	b.WriteString("ET")
+	return b.String()
+}
+
+// Escapes a string for a PDF literal. The fonts use WinAnsi, so Latin-1
+// characters come through and anything else prints as '?'.
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r <= 0x7e:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
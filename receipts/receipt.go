@@ -0,0 +1,218 @@
+package receipts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang-restaurant-management/models"
+)
+
+const (
+	FormatText   = "text"
+	FormatPDF    = "pdf"
+	FormatESCPOS = "escpos"
+)
+
+const defaultLineWidth = 42
+
+// Receipt is everything printed for one invoice, already priced.
+type Receipt struct {
+	Invoice_id      string
+	Table_number    string
+	Printed_at      time.Time
+	Items           []Item
+	Subtotal        models.Money
+	Discounts       []Charge
+	Service_charges []Charge
+	Taxes           []Tax
+	Total           models.Money
+	Payments        []Tender
+	Paid            models.Money
+	Balance         models.Money
+}
+
+type Item struct {
+	Name     string
+	Size     string
+	Quantity int64
+	Amount   models.Money
+}
+
+type Charge struct {
+	Label  string
+	Amount models.Money
+}
+
+type Tax struct {
+	Label     string
+	Amount    models.Money
+	Inclusive bool
+}
+
+type Tender struct {
+	Method string
+	Amount models.Money
+	Tip    models.Money
+	Change models.Money
+}
+
+const (
+	AlignLeft = iota
+	AlignCenter
+	AlignRight
+)
+
+// Line is one printed row. Every format prints the same lines, so a receipt
+// reads the same on paper, on screen and in a PDF.
+type Line struct {
+	Text  string
+	Align int
+	Bold  bool
+	Large bool
+}
+
+// Render produces the receipt in the given format along with its content type.
+func Render(format string, receipt Receipt, template models.ReceiptTemplate) ([]byte, string, error) {
+	lines, width := Layout(receipt, template)
+	switch format {
+	case FormatText:
+		return Text(lines, width), "text/plain; charset=utf-8", nil
+	case FormatPDF:
+		return PDF(lines, width), "application/pdf", nil
+	case FormatESCPOS:
+		return ESCPOS(lines, width), "application/octet-stream", nil
+	default:
+		return nil, "", fmt.Errorf("unknown receipt format %q", format)
+	}
+}
+
+// Layout lays the receipt out in lines of the template's width.
+func Layout(receipt Receipt, template models.ReceiptTemplate) ([]Line, int) {
+	width := defaultLineWidth
+	if template.Line_width != nil {
+		width = *template.Line_width
+	}
+	showSizes := template.Show_sizes == nil || *template.Show_sizes
+	currency := receipt.Total.Currency
+
+	var lines []Line
+	center := func(text string) {
+		lines = append(lines, Line{Text: text, Align: AlignCenter})
+	}
+	row := func(label, amount string, bold bool) {
+		lines = append(lines, Line{Text: columns(label, amount, width), Bold: bold})
+	}
+	rule := func() {
+		lines = append(lines, Line{Text: strings.Repeat("-", width)})
+	}
+
+	if template.Restaurant_name != nil {
+		lines = append(lines, Line{Text: *template.Restaurant_name, Align: AlignCenter, Bold: true, Large: true})
+	}
+	for _, text := range template.Header_lines {
+		center(text)
+	}
+	if template.Tax_number != nil && *template.Tax_number != "" {
+		center("Tax no. " + *template.Tax_number)
+	}
+	rule()
+	row("Invoice "+receipt.Invoice_id, "", false)
+	if receipt.Table_number != "" {
+		row("Table "+receipt.Table_number, receipt.Printed_at.Format("2006-01-02 15:04"), false)
+	} else {
+		row(receipt.Printed_at.Format("2006-01-02 15:04"), "", false)
+	}
+	rule()
+
+	for _, item := range receipt.Items {
+		name := item.Name
+		if showSizes && item.Size != "" {
+			name += " (" + item.Size + ")"
+		}
+		row(strconv.FormatInt(item.Quantity, 10)+" x "+name, item.Amount.Decimal(), false)
+	}
+	rule()
+
+	row("Subtotal", receipt.Subtotal.Decimal(), false)
+	for _, discount := range receipt.Discounts {
+		row(discount.Label, "-"+discount.Amount.Decimal(), false)
+	}
+	for _, charge := range receipt.Service_charges {
+		row(charge.Label, charge.Amount.Decimal(), false)
+	}
+	for _, tax := range receipt.Taxes {
+		label := tax.Label
+		if tax.Inclusive {
+			label += " (incl.)"
+		}
+		row(label, tax.Amount.Decimal(), false)
+	}
+	row("TOTAL "+currency, receipt.Total.Decimal(), true)
+
+	if len(receipt.Payments) > 0 {
+		rule()
+		for _, payment := range receipt.Payments {
+			row(payment.Method, payment.Amount.Decimal(), false)
+			if payment.Tip.Amount != 0 {
+				row("  Tip", payment.Tip.Decimal(), false)
+			}
+			if payment.Change.Amount != 0 {
+				row("  Change", payment.Change.Decimal(), false)
+			}
+		}
+		row("Paid", receipt.Paid.Decimal(), false)
+		if receipt.Balance.Amount != 0 {
+			row("Balance due", receipt.Balance.Decimal(), true)
+		}
+	}
+
+	if len(template.Footer_lines) > 0 {
+		rule()
+		for _, text := range template.Footer_lines {
+			center(text)
+		}
+	}
+	return lines, width
+}
+
+// Puts the label on the left and the amount on the right, shortening the
+// label when both do not fit.
+func columns(label, amount string, width int) string {
+	if amount == "" {
+		return truncate(label, width)
+	}
+	space := width - utf8.RuneCountInString(amount) - 1
+	if utf8.RuneCountInString(label) > space {
+		label = truncate(label, space)
+	}
+	return label + strings.Repeat(" ", width-utf8.RuneCountInString(label)-utf8.RuneCountInString(amount)) + amount
+}
+
+func truncate(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:width])
+}
+
+// pad aligns text within the width with spaces, for formats that have no
+// alignment of their own.
+func pad(line Line, width int) string {
+	text := truncate(line.Text, width)
+	gap := width - utf8.RuneCountInString(text)
+	switch line.Align {
+	case AlignCenter:
+		return strings.Repeat(" ", gap/2) + text
+	case AlignRight:
+		return strings.Repeat(" ", gap) + text
+	default:
+		return text
+	}
+}
@@ -0,0 +1,15 @@
+package receipts
+
+import (
+	"strings"
+)
+
+// Text prints the lines as plain text, padded with spaces to line up.
+func Text(lines []Line, width int) []byte {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimRight(pad(line, width), " "))
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,69 @@
+package receipts
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ticket is the kitchen's copy of the items one station has to prepare for
+// an order.
+type Ticket struct {
+	Station      string
+	Order_id     string
+	Table_number string
+	Server       string
+	Printed_at   time.Time
+	Items        []TicketItem
+}
+
+type TicketItem struct {
+	Name      string
+	Size      string
+	Quantity  int
+	Seat      int
+	Modifiers []string
+	Notes     string
+}
+
+// TicketLayout lays a ticket out for a station printer. Cooks read tickets
+// from across the pass, so the table and items are printed large and there
+// are no prices.
+func TicketLayout(ticket Ticket, width int) []Line {
+	if width <= 0 {
+		width = defaultLineWidth
+	}
+	rule := Line{Text: strings.Repeat("-", width)}
+
+	lines := []Line{
+		{Text: ticket.Station, Align: AlignCenter, Bold: true, Large: true},
+	}
+	if ticket.Table_number != "" {
+		lines = append(lines, Line{Text: "Table " + ticket.Table_number, Align: AlignCenter, Bold: true, Large: true})
+	}
+	lines = append(lines,
+		Line{Text: columns("Order "+ticket.Order_id, ticket.Printed_at.Format("15:04"), width)},
+	)
+	if ticket.Server != "" {
+		lines = append(lines, Line{Text: "Server " + ticket.Server})
+	}
+	lines = append(lines, rule)
+
+	for _, item := range ticket.Items {
+		name := item.Name
+		if item.Size != "" {
+			name += " (" + item.Size + ")"
+		}
+		lines = append(lines, Line{Text: strconv.Itoa(item.Quantity) + " x " + name, Bold: true, Large: true})
+		for _, modifier := range item.Modifiers {
+			lines = append(lines, Line{Text: "  + " + modifier, Bold: true})
+		}
+		if item.Notes != "" {
+			lines = append(lines, Line{Text: "  ** " + item.Notes, Bold: true})
+		}
+		if item.Seat > 0 {
+			lines = append(lines, Line{Text: "    seat " + strconv.Itoa(item.Seat)})
+		}
+	}
+	return append(lines, rule)
+}
@@ -3,54 +3,174 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"golang-restaurant-management/controllers"
+	"golang-restaurant-management/middleware"
+	"golang-restaurant-management/models"
 )
 
 func RegisterRoutes(router fiber.Router) {
+	admins := middleware.Authorization()
+	managers := middleware.Authorization(models.RoleManager)
+	floorStaff := middleware.Authorization(models.RoleManager, models.RoleWaiter)
+	kitchenStaff := middleware.Authorization(models.RoleManager, models.RoleWaiter, models.RoleChef)
+	cashiers := middleware.Authorization(models.RoleManager, models.RoleCashier)
+	billing := middleware.Authorization(models.RoleManager, models.RoleCashier, models.RoleWaiter)
+
 	// User routes
 	user := router.Group("/users")
-	user.Get("/", controller.GetUsers)
-	user.Get("/:user_id", controller.GetUser)
+	user.Get("/", managers, controller.GetUsers)
+	user.Get("/:user_id", managers, controller.GetUser)
+	user.Patch("/:user_id/role", admins, controller.UpdateUserRole)
+	user.Post("/logout", controller.Logout)
+	user.Post("/:user_id/revoke-sessions", admins, controller.RevokeSessions)
 
 	// Food routes
 	food := router.Group("/foods")
 	food.Get("/", controller.GetFoods)
+	food.Get("/availability", controller.GetFoodAvailability)
+	food.Get("/availability/feed", controller.AvailabilityFeed)
 	food.Get("/:food_id", controller.GetFood)
-	food.Post("/", controller.CreateFood)
-	food.Patch("/:food_id", controller.UpdateFood)
+	food.Post("/", managers, controller.CreateFood)
+	food.Patch("/:food_id", managers, controller.UpdateFood)
+	food.Put("/:food_id/recipe", managers, controller.SetRecipe)
+	food.Put("/:food_id/availability", kitchenStaff, controller.SetFoodAvailability)
 
 	// Menu routes
 	menu := router.Group("/menus")
 	menu.Get("/", controller.GetMenus)
 	menu.Get("/:menu_id", controller.GetMenu)
-	menu.Post("/", controller.CreateMenu)
-	menu.Patch("/:menu_id", controller.UpdateMenu)
+	menu.Post("/", managers, controller.CreateMenu)
+	menu.Patch("/:menu_id", managers, controller.UpdateMenu)
 
 	// Table routes
 	table := router.Group("/tables")
 	table.Get("/", controller.GetTables)
+	table.Get("/floor", controller.GetFloorOverview)
 	table.Get("/:table_id", controller.GetTable)
-	table.Post("/", controller.CreateTable)
-	table.Patch("/:table_id", controller.UpdateTable)
+	table.Post("/", managers, controller.CreateTable)
+	table.Patch("/:table_id", managers, controller.UpdateTable)
+	table.Post("/:table_id/status", floorStaff, controller.UpdateTableStatus)
+
+	// Reservation routes
+	reservation := router.Group("/reservations", floorStaff)
+	reservation.Get("/", controller.GetReservations)
+	reservation.Get("/availability", controller.GetTableAvailability)
+	reservation.Get("/:reservation_id", controller.GetReservation)
+	reservation.Post("/", controller.CreateReservation)
+	reservation.Patch("/:reservation_id", controller.UpdateReservation)
+	reservation.Post("/:reservation_id/check-in", controller.CheckInReservation)
 
 	// Order routes
 	order := router.Group("/orders")
 	order.Get("/", controller.GetOrders)
 	order.Get("/:order_id", controller.GetOrder)
-	order.Post("/", controller.CreateOrder)
-	order.Patch("/:order_id", controller.UpdateOrder)
+	order.Post("/", floorStaff, controller.CreateOrder)
+	order.Patch("/:order_id", floorStaff, controller.UpdateOrder)
+	order.Post("/:order_id/status", kitchenStaff, controller.UpdateOrderStatus)
 
 	// OrderItem routes
 	orderItem := router.Group("/orderItems")
 	orderItem.Get("/", controller.GetOrderItems)
-	orderItem.Get("/:orderItem_id", controller.GetOrderItem)
+	orderItem.Get("/:order_item_id", controller.GetOrderItem)
 	orderItem.Get("-order/:order_id", controller.GetOrderItemsByOrder)
-	orderItem.Post("/", controller.CreateOrderItem)
-	orderItem.Patch("/:orderItem_id", controller.UpdateOrderItem)
+	orderItem.Post("/", floorStaff, controller.CreateOrderItem)
+	orderItem.Patch("/:order_item_id", floorStaff, controller.UpdateOrderItem)
+	orderItem.Post("/:order_item_id/void", managers, controller.VoidOrderItem)
+
+	// Kitchen display routes
+	kitchen := router.Group("/kitchen", kitchenStaff)
+	kitchen.Get("/tickets", controller.GetKitchenTickets)
+	kitchen.Get("/feed", controller.KitchenFeed)
+	kitchen.Post("/items/:order_item_id/acknowledge", controller.AcknowledgeOrderItem)
+	kitchen.Post("/items/:order_item_id/bump", controller.BumpOrderItem)
+	kitchen.Get("/print-jobs", controller.GetPrintJobs)
+	kitchen.Post("/print-jobs/:print_job_id/retry", controller.RetryPrintJob)
+
+	// Inventory routes
+	ingredient := router.Group("/ingredients", kitchenStaff)
+	ingredient.Get("/", controller.GetIngredients)
+	ingredient.Get("/feed", controller.InventoryFeed)
+	ingredient.Get("/:ingredient_id", controller.GetIngredient)
+	ingredient.Get("/:ingredient_id/movements", controller.GetStockMovements)
+	ingredient.Post("/", managers, controller.CreateIngredient)
+	ingredient.Patch("/:ingredient_id", managers, controller.UpdateIngredient)
+	ingredient.Post("/:ingredient_id/adjustments", controller.AdjustStock)
+
+	// Purchasing routes
+	supplier := router.Group("/suppliers", managers)
+	supplier.Get("/", controller.GetSuppliers)
+	supplier.Get("/:supplier_id", controller.GetSupplier)
+	supplier.Post("/", controller.CreateSupplier)
+	supplier.Patch("/:supplier_id", controller.UpdateSupplier)
+	supplier.Put("/:supplier_id/prices", controller.SetSupplierPrices)
+
+	purchaseOrder := router.Group("/purchase-orders", managers)
+	purchaseOrder.Get("/", controller.GetPurchaseOrders)
+	purchaseOrder.Get("/suggested", controller.SuggestReorders)
+	purchaseOrder.Get("/:purchase_order_id", controller.GetPurchaseOrder)
+	purchaseOrder.Post("/", controller.CreatePurchaseOrder)
+	purchaseOrder.Patch("/:purchase_order_id", controller.UpdatePurchaseOrder)
+	purchaseOrder.Post("/:purchase_order_id/send", controller.SendPurchaseOrder)
+	purchaseOrder.Post("/:purchase_order_id/receive", controller.ReceivePurchaseOrder)
+	purchaseOrder.Post("/:purchase_order_id/cancel", controller.CancelPurchaseOrder)
+
+	// Prep station routes
+	station := router.Group("/stations")
+	station.Get("/", kitchenStaff, controller.GetStations)
+	station.Post("/", managers, controller.CreateStation)
+	station.Patch("/:station_id", managers, controller.UpdateStation)
+
+	// Tax routes
+	tax := router.Group("/taxes")
+	tax.Get("/", billing, controller.GetTaxRules)
+	tax.Get("/:tax_id", billing, controller.GetTaxRule)
+	tax.Post("/", managers, controller.CreateTaxRule)
+	tax.Patch("/:tax_id", managers, controller.UpdateTaxRule)
+	tax.Delete("/:tax_id", managers, controller.RetireTaxRule)
 
 	// Invoice routes
 	invoice := router.Group("/invoices")
-	invoice.Get("/", controller.GetInvoices)
-	invoice.Get("/:invoice_id", controller.GetInvoice)
-	invoice.Post("/", controller.CreateInvoice)
-	invoice.Patch("/:invoice_id", controller.UpdateInvoice)
+	invoice.Get("/", billing, controller.GetInvoices)
+	invoice.Get("/:invoice_id", billing, controller.GetInvoice)
+	invoice.Post("/", billing, controller.CreateInvoice)
+	invoice.Post("/split", billing, controller.SplitInvoice)
+	invoice.Post("/:invoice_id/payments", cashiers, controller.RecordPayment)
+	invoice.Patch("/:invoice_id", cashiers, controller.UpdateInvoice)
+	invoice.Post("/:invoice_id/discounts", billing, controller.ApplyInvoiceDiscount)
+	invoice.Delete("/:invoice_id/discounts/:discount_id", managers, controller.RemoveInvoiceDiscount)
+	invoice.Post("/:invoice_id/comps", managers, controller.CompInvoice)
+	invoice.Post("/:invoice_id/refunds", managers, controller.RefundInvoice)
+	invoice.Get("/:invoice_id/receipt", billing, controller.GetReceipt)
+
+	// Receipt template routes
+	receiptTemplate := router.Group("/receipt-template")
+	receiptTemplate.Get("/", billing, controller.GetReceiptTemplate)
+	receiptTemplate.Put("/", managers, controller.UpdateReceiptTemplate)
+
+	// Business day routes
+	businessDay := router.Group("/business-days", cashiers)
+	businessDay.Get("/", controller.GetBusinessDays)
+	businessDay.Get("/:date", controller.GetBusinessDay)
+	businessDay.Post("/:date/close", controller.CloseBusinessDay)
+
+	// Service charge routes
+	serviceCharge := router.Group("/service-charges")
+	serviceCharge.Get("/", billing, controller.GetServiceCharges)
+	serviceCharge.Post("/", managers, controller.CreateServiceCharge)
+	serviceCharge.Patch("/:service_charge_id", managers, controller.UpdateServiceCharge)
+
+	// Report routes
+	report := router.Group("/reports", managers)
+	report.Get("/tips", controller.GetTipReport)
+	report.Get("/adjustments", controller.GetAdjustmentReport)
+	report.Get("/revenue", controller.GetRevenueReport)
+	report.Get("/sellers", controller.GetSellersReport)
+	report.Get("/servers", controller.GetServerSalesReport)
+	report.Get("/table-turnover", controller.GetTableTurnoverReport)
+
+	// Promotion routes
+	promotion := router.Group("/promotions")
+	promotion.Get("/", billing, controller.GetPromotions)
+	promotion.Get("/:promotion_id", billing, controller.GetPromotion)
+	promotion.Post("/", managers, controller.CreatePromotion)
+	promotion.Patch("/:promotion_id", managers, controller.UpdatePromotion)
 }